@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/floriansw/go-tcadmin"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+	"github.com/floriansw/hll-discord-server-watcher/internal/watcher"
+)
+
+// validate checks the config at path and prints all problems found. It returns the exit code of the command.
+func validate(logger *slog.Logger, path string) int {
+	c, err := internal.NewConfig(path, logger)
+	if err == nil {
+		err = c.Validate()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("The config is valid.")
+	return 0
+}
+
+// check queries the server with the given name from its control panel and prints the result, without touching the
+// state or discord. It returns the exit code of the command.
+func check(logger *slog.Logger, path, name string) int {
+	c, err := internal.NewConfig(path, logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	idx := slices.IndexFunc(c.Servers, func(s internal.Server) bool {
+		return s.Name == name
+	})
+	if idx == -1 {
+		var names []string
+		for _, s := range c.Servers {
+			names = append(names, s.Name)
+		}
+		fmt.Fprintf(os.Stderr, "unknown server %s, configured servers are: %s\n", name, strings.Join(names, ", "))
+		return 1
+	}
+	server, _, err := newServer(c, c.Servers[idx], nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	source := watcher.PasswordSource(server.Config)
+	fmt.Printf("Server:          %s\n", name)
+	fmt.Printf("Password source: %s\n", passwordSourceDescription(source))
+	si, err := watcher.Query(context.Background(), server)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not query the server: %s\n", err)
+		return 1
+	}
+	fmt.Printf("Server name:     %s\n", si.Name)
+	fmt.Printf("Password:        %s\n", si.Password)
+	if si.Name == "" {
+		fmt.Fprintln(os.Stderr, "The server name is empty, the control panel page could not be read.")
+		return 1
+	}
+	return 0
+}
+
+func passwordSourceDescription(s tcadmin.PasswordSource) string {
+	switch s {
+	case tcadmin.PasswordSourceServiceCmdLine:
+		return "command line of the service (" + string(s) + ")"
+	default:
+		return "configuration page (" + string(s) + ")"
+	}
+}
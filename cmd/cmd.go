@@ -1,17 +1,17 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 	"time"
 
-	"github.com/bwmarrin/discordgo"
 	"github.com/floriansw/go-tcadmin"
-	"github.com/floriansw/hll-discord-server-watcher/discord"
 	"github.com/floriansw/hll-discord-server-watcher/internal"
 	"github.com/floriansw/hll-discord-server-watcher/internal/watcher"
 )
@@ -20,8 +20,27 @@ const (
 	hllGameId = "1098726659"
 	hllModId  = "0"
 	hllFileId = "1"
+
+	defaultPollConcurrency = 4
+	webhookTimeout         = 30 * time.Second
+
+	defaultConfigPath = "./config.json"
+	// defaultStatePath is the file the runtime state is persisted in, its directory must be writable
+	defaultStatePath = "./data/state.json"
 )
 
+const usage = `Usage: %s [command] [flags]
+
+Commands:
+  run             polls the servers and publishes their status until stopped (default)
+  once            polls the servers and publishes their status a single time, fails if a server could not be polled
+  validate        checks the config and lists all problems
+  check <server>  queries the control panel of a server and prints the result without publishing it
+  encrypt-config  encrypts the passwords and the bot token in the config with the key of the environment
+
+Flags:
+`
+
 func main() {
 	level := slog.LevelInfo
 	if _, ok := os.LookupEnv("DEBUG"); ok {
@@ -30,44 +49,89 @@ func main() {
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
 
-	c, err := internal.NewConfig("./config.json", logger)
-	if err != nil {
-		logger.Error("config", err)
-		return
-	}
-
-	var s *discordgo.Session
-	if c.Discord != nil {
-		s, err = discordgo.New("Bot " + c.Discord.Token)
-		if err != nil {
-			logger.Error("discord", err)
-			return
-		}
+	cmd, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
 	}
-	if err = os.MkdirAll("./matches/", 0644); err != nil {
-		logger.Error("create-matches", err)
-		return
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "path of the config file")
+	statePath := fs.String("state", defaultStatePath, "path of the state file of run and once, its directory must be writable")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), usage, os.Args[0])
+		fs.PrintDefaults()
 	}
-	h := discord.New(logger, c, s)
-	if s != nil {
-		s.AddHandlerOnce(func(s *discordgo.Session, e *discordgo.Ready) {
-			if err := h.Listen(); err != nil {
-				logger.Error("discord-listen", err)
-				panic(err)
+	_ = fs.Parse(args)
+	// withoutState exits, if --state is passed to a command which does not use the state.
+	withoutState := func() {
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "state" {
+				fmt.Fprintf(fs.Output(), "the command %s does not use the state, -state is not supported\n", cmd)
+				fs.Usage()
+				os.Exit(2)
 			}
-			logger.Info("ready")
 		})
-		err = s.Open()
-		if err != nil {
-			logger.Error("open-session", err)
-			return
+	}
+
+	switch cmd {
+	case "run":
+		os.Exit(run(logger, *configPath, *statePath, false))
+	case "once":
+		os.Exit(run(logger, *configPath, *statePath, true))
+	case "validate":
+		withoutState()
+		os.Exit(validate(logger, *configPath))
+	case "check":
+		withoutState()
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
 		}
-		defer s.Close()
+		os.Exit(check(logger, *configPath, fs.Arg(0)))
+	case "encrypt-config":
+		withoutState()
+		os.Exit(encryptConfig(logger, *configPath))
+	default:
+		fmt.Fprintf(fs.Output(), "unknown command %s\n", cmd)
+		fs.Usage()
+		os.Exit(2)
 	}
-	defer h.Close()
+}
 
+// newServers creates the watched servers of the config. Clients of the previous servers are reused if the connection
+// to the control panel did not change, to keep their login session. The returned clients are passed as previous when
+// the config changed.
+func newServers(c *internal.Config, previous map[string]watcher.ServerQuery) ([]watcher.Server, map[string]watcher.ServerQuery, error) {
 	var servers []watcher.Server
+	clients := map[string]watcher.ServerQuery{}
 	for _, server := range c.Servers {
+		s, key, err := newServer(c, server, previous)
+		if err != nil {
+			return nil, nil, err
+		}
+		clients[key] = s.Query
+		servers = append(servers, s)
+	}
+	return servers, clients, nil
+}
+
+// newServer creates the watched server for a single server of the config, see newServers. It returns the key of its
+// client in the clients of newServers, too.
+func newServer(c *internal.Config, server internal.Server, previous map[string]watcher.ServerQuery) (watcher.Server, string, error) {
+	baseUrl := c.ControlPanelBaseUrl
+	if server.ControlPanelBaseUrl != nil {
+		baseUrl = *server.ControlPanelBaseUrl
+	}
+	gameId := hllGameId
+	if server.GameId != nil {
+		gameId = *server.GameId
+	}
+	creds, err := server.Credentials.Resolve()
+	if err != nil {
+		return watcher.Server{}, "", fmt.Errorf("credentials of %s: %w", server.Name, err)
+	}
+	key := strings.Join([]string{server.Name, baseUrl, gameId, creds.Username, creds.Password}, "\x00")
+	q, ok := previous[key]
+	if !ok {
 		jar, err := cookiejar.New(nil)
 		if err != nil {
 			panic(err)
@@ -78,34 +142,65 @@ func main() {
 				return http.ErrUseLastResponse
 			},
 		}
-		baseUrl := c.ControlPanelBaseUrl
-		if server.ControlPanelBaseUrl != nil {
-			baseUrl = *server.ControlPanelBaseUrl
-		}
-		gameId := hllGameId
-		if server.GameId != nil {
-			gameId = *server.GameId
-		}
-		servers = append(servers, watcher.Server{
-			Query: tcadmin.NewClient(hc, baseUrl, gameId, hllModId, hllFileId, tcadmin.Credentials{
-				Username: server.Credentials.Username,
-				Password: server.Credentials.Password,
-			}),
-			Config: server,
+		q = watcher.NewTCAdminServer(hc, baseUrl, gameId, hllModId, hllFileId, tcadmin.Credentials{
+			Username: creds.Username,
+			Password: creds.Password,
 		})
 	}
-	interval := 10 * time.Minute
+	return watcher.Server{Query: q, Config: server}, key, nil
+}
+
+// publishers returns the discord publisher dp, if the bot is used, together with a publisher for each webhook. Webhooks
+// which still have messages in the state, but are not configured anymore, get a publisher deleting these messages.
+func publishers(l *slog.Logger, c *internal.Config, state *internal.State, dp watcher.Publisher) []watcher.Publisher {
+	var publishers []watcher.Publisher
+	if dp != nil {
+		publishers = append(publishers, dp)
+	}
+	configured := map[string]bool{}
+	for _, webhook := range c.Webhooks {
+		configured[webhook.Url] = true
+		publishers = append(publishers, watcher.NewWebhookPublisher(l, &http.Client{Timeout: webhookTimeout}, webhook.Url, webhook.Servers, state))
+	}
+	for _, url := range state.WebhookUrls() {
+		if !configured[url] {
+			publishers = append(publishers, watcher.NewRemovedWebhookPublisher(l, &http.Client{Timeout: webhookTimeout}, url, state))
+		}
+	}
+	return publishers
+}
+
+func interval(c *internal.Config) time.Duration {
 	if c.PollIntervalSeconds != nil {
-		interval = time.Duration(*c.PollIntervalSeconds) * time.Second
+		return time.Duration(*c.PollIntervalSeconds) * time.Second
 	}
-	watcher.NewWatcher(logger, s, c, servers, interval).Run()
+	return 10 * time.Minute
+}
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-	<-stop
+func concurrency(c *internal.Config) int {
+	if c.PollConcurrency != nil {
+		return *c.PollConcurrency
+	}
+	return defaultPollConcurrency
+}
 
-	logger.Info("graceful-shutdown")
-	if err := c.Save(); err != nil {
-		logger.Error("save-config", "error", err)
+// restartRequired returns an error if the changes between the current and new config can not be applied while the
+// application is running. The resolved tokens are compared, so that e.g. encrypting the config does not require a
+// restart.
+func restartRequired(current, n *internal.Config) error {
+	if (current.Discord == nil) != (n.Discord == nil) {
+		return errors.New("adding or removing the discord bot requires a restart")
+	}
+	if n.Discord == nil {
+		return nil
+	}
+	ct, _ := current.Discord.ResolveToken()
+	nt, err := n.Discord.ResolveToken()
+	if err != nil {
+		return err
+	}
+	if ct != nt {
+		return errors.New("changes of the discord bot token require a restart")
 	}
+	return nil
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+)
+
+// encryptConfig encrypts the plaintext secrets of the config at path and saves it. It returns the exit code of the
+// command.
+func encryptConfig(logger *slog.Logger, path string) int {
+	c, err := internal.NewConfig(path, logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	count, err := c.EncryptSecrets()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintf(os.Stderr, "Generate a key with e.g. `openssl rand -base64 32` and pass it in %s or %s.\n", internal.KeyEnv, internal.KeyFileEnv)
+		return 1
+	}
+	if count == 0 {
+		fmt.Println("The config does not contain plaintext secrets.")
+		return 0
+	}
+	if err := c.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Encrypted %d secret(s) in %s.\n", count, path)
+	return 0
+}
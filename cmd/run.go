@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/floriansw/hll-discord-server-watcher/discord"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+	"github.com/floriansw/hll-discord-server-watcher/internal/watcher"
+)
+
+// run polls the servers and publishes their status until the process is stopped. If once is true, the servers are
+// polled and published a single time only, without connecting the bot for its commands. It returns the exit code of
+// the command.
+func run(logger *slog.Logger, configPath, statePath string, once bool) int {
+	c, err := internal.NewConfig(configPath, logger)
+	if err != nil {
+		logger.Error("config", "error", err)
+		return 1
+	}
+	if err = c.Validate(); err != nil {
+		logger.Error("config", "reason", "refusing to start with an invalid config")
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	config := &atomic.Pointer[internal.Config]{}
+	config.Store(c)
+	if err = os.MkdirAll(filepath.Dir(statePath), 0755); err != nil {
+		logger.Error("create-state-dir", "error", err)
+		return 1
+	}
+	state, err := internal.NewState(statePath, c, logger)
+	if err != nil {
+		logger.Error("state", "error", err)
+		return 1
+	}
+
+	var s *discordgo.Session
+	if c.Discord != nil {
+		token, err := c.Discord.ResolveToken()
+		if err != nil {
+			logger.Error("discord", "error", err)
+			return 1
+		}
+		s, err = discordgo.New("Bot " + token)
+		if err != nil {
+			logger.Error("discord", "error", err)
+			return 1
+		}
+	}
+	var dp watcher.Publisher
+	if s != nil {
+		p := watcher.NewDiscordPublisher(logger, s, config, state)
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.MessageDelete) {
+			p.MessageDeleted(e.ID)
+		})
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.MessageDeleteBulk) {
+			for _, id := range e.Messages {
+				p.MessageDeleted(id)
+			}
+		})
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.ChannelDelete) {
+			p.ChannelDeleted(e.ID)
+		})
+		dp = p
+	}
+	servers, clients, err := newServers(c, nil)
+	if err != nil {
+		logger.Error("servers", "error", err)
+		return 1
+	}
+	w := watcher.NewWatcher(logger, servers, publishers(logger, c, state, dp), state, interval(c), concurrency(c))
+	if once {
+		if err := w.Once(); err != nil {
+			logger.Error("once", "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	if err = os.MkdirAll("./matches/", 0644); err != nil {
+		logger.Error("create-matches", "error", err)
+		return 1
+	}
+	h := discord.New(logger, config, s, w)
+	if s != nil {
+		s.AddHandlerOnce(func(s *discordgo.Session, e *discordgo.Ready) {
+			if err := h.Listen(); err != nil {
+				logger.Error("discord-listen", "error", err)
+				panic(err)
+			}
+			logger.Info("ready")
+		})
+		err = s.Open()
+		if err != nil {
+			logger.Error("open-session", "error", err)
+			return 1
+		}
+		defer s.Close()
+	}
+
+	w.Run()
+
+	cw, err := internal.WatchConfig(configPath, logger, func(n *internal.Config) error {
+		if err := restartRequired(config.Load(), n); err != nil {
+			return err
+		}
+		servers, current, err := newServers(n, clients)
+		if err != nil {
+			return err
+		}
+		clients = current
+		config.Store(n)
+		w.Reload(servers, publishers(logger, n, state, dp), interval(n), concurrency(n))
+		if s != nil {
+			if err := h.RegisterCommands(); err != nil {
+				logger.Error("register-commands", "error", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("watch-config", "error", err)
+	} else {
+		defer cw.Close()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	logger.Info("graceful-shutdown")
+	w.Shutdown()
+	return 0
+}
@@ -5,17 +5,26 @@ import (
 	"github.com/bwmarrin/discordgo"
 	"github.com/floriansw/hll-discord-server-watcher/internal"
 	"log/slog"
+	"slices"
+	"sync/atomic"
 )
 
 type discordApp struct {
 	logger          *slog.Logger
 	session         *discordgo.Session
-	config          *internal.Config
+	config          *atomic.Pointer[internal.Config]
 	commands        []*discordgo.ApplicationCommand
 	commandHandlers map[string]internal.Command
 }
 
-func New(logger *slog.Logger, c *internal.Config, session *discordgo.Session) *discordApp {
+// Watcher provides access to the watched servers for the commands of the bot.
+type Watcher interface {
+	ServerState
+	ServerConfigurer
+	ServerRestarter
+}
+
+func New(logger *slog.Logger, c *atomic.Pointer[internal.Config], session *discordgo.Session, w Watcher) *discordApp {
 	handler := &discordApp{
 		logger:   logger,
 		session:  session,
@@ -23,7 +32,11 @@ func New(logger *slog.Logger, c *internal.Config, session *discordgo.Session) *d
 		commands: []*discordgo.ApplicationCommand{},
 	}
 
-	handler.commandHandlers = map[string]internal.Command{}
+	handler.commandHandlers = map[string]internal.Command{
+		"password":    &passwordCommand{logger: logger, config: c, state: w},
+		"setpassword": &setPasswordCommand{logger: logger, config: c, state: w, configurer: w},
+		"restart":     &restartCommand{logger: logger, config: c, restarter: w},
+	}
 	for cmd, command := range handler.commandHandlers {
 		handler.commands = append(handler.commands, command.Definition(cmd))
 	}
@@ -41,30 +54,12 @@ func containsCommand(c []*discordgo.ApplicationCommand, cmd string) bool {
 }
 
 func (a *discordApp) Listen() error {
-	cmds, err := a.session.ApplicationCommands(a.session.State.User.ID, a.config.Discord.GuildId)
-	if err != nil {
+	if err := a.RegisterCommands(); err != nil {
 		return err
 	}
-	for _, command := range cmds {
-		if !containsCommand(a.commands, command.Name) {
-			if err := a.session.ApplicationCommandDelete(a.session.State.User.ID, a.config.Discord.GuildId, command.ID); err != nil {
-				a.logger.Error("delete-command", err, "name", command.Name)
-			}
-		}
-	}
-
-	for _, v := range a.commands {
-		if containsCommand(cmds, v.Name) {
-			continue
-		}
-		_, err := a.session.ApplicationCommandCreate(a.session.State.User.ID, a.config.Discord.GuildId, v)
-		if err != nil {
-			a.logger.Error("create-command", err, "command", v)
-		}
-	}
 
 	a.session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		if i.GuildID != a.config.Discord.GuildId {
+		if !slices.Contains(a.config.Load().Guilds(), i.GuildID) {
 			a.error(s, i.Interaction, "The command is not available for your discord server.")
 			return
 		}
@@ -72,6 +67,7 @@ func (a *discordApp) Listen() error {
 			name string
 			h    internal.Command
 			mc   internal.MessageComponent
+			ms   internal.ModalSubmit
 			ok   bool
 		)
 		switch i.Type {
@@ -88,6 +84,7 @@ func (a *discordApp) Listen() error {
 			for cmd, command := range a.commandHandlers {
 				if cast, ok := command.(internal.MessageComponent); ok && cast.CanHandle(cid) {
 					name = cmd
+					h = command
 					mc = cast
 				}
 			}
@@ -98,20 +95,29 @@ func (a *discordApp) Listen() error {
 		case discordgo.InteractionModalSubmit:
 			cid := i.ModalSubmitData().CustomID
 			a.logger.Info("modalsubmit", "custom_id", cid)
-			for _, command := range a.commandHandlers {
+			for cmd, command := range a.commandHandlers {
 				if cast, ok := command.(internal.ModalSubmit); ok && cast.CanHandle(cid) {
-					cast.OnModalSubmit(s, i)
-					return
+					name = cmd
+					h = command
+					ms = cast
 				}
 			}
-			a.error(s, i.Interaction, "Command does not support modal submit: "+cid)
-			return
+			if ms == nil {
+				a.error(s, i.Interaction, "Command does not support modal submit: "+cid)
+				return
+			}
 		default:
-			a.logger.Error("unhandled-interaction", errors.New("unhandled: "+i.Type.String()))
+			a.logger.Error("unhandled-interaction", "error", errors.New("unhandled: "+i.Type.String()))
 			a.error(s, i.Interaction, "unhandled interaction type: "+i.Type.String())
 			return
 		}
 
+		if i.Type != discordgo.InteractionApplicationCommandAutocomplete && !a.allowed(name, h, i.Member) {
+			a.logger.Info("permission-denied", "name", name, "user", interactionUser(i))
+			a.error(s, i.Interaction, "You are not allowed to use the command "+name+".")
+			return
+		}
+
 		switch i.Type {
 		case discordgo.InteractionApplicationCommandAutocomplete:
 			a.logger.Info("autocomplete", "name", name)
@@ -123,6 +129,8 @@ func (a *discordApp) Listen() error {
 		case discordgo.InteractionMessageComponent:
 			a.logger.Info("messagecomponent", "name", name)
 			mc.OnMessageComponent(s, i)
+		case discordgo.InteractionModalSubmit:
+			ms.OnModalSubmit(s, i)
 		case discordgo.InteractionApplicationCommand:
 			a.logger.Info("command", "name", name)
 			h.OnCommand(s, i)
@@ -131,19 +139,58 @@ func (a *discordApp) Listen() error {
 	return nil
 }
 
-func (a *discordApp) error(s *discordgo.Session, i *discordgo.Interaction, msg string) {
-	s.InteractionRespond(i, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Content: msg,
-			Flags:   discordgo.MessageFlagsEphemeral,
-		},
-	})
+// RegisterCommands registers the commands of the bot in all discord servers of the current config. It is called
+// again after the config was reloaded, to make the commands available in newly configured discord servers.
+func (a *discordApp) RegisterCommands() error {
+	for _, guild := range a.config.Load().Guilds() {
+		if err := a.registerCommands(guild); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (a *discordApp) Close() {
-	err := a.config.Save()
+// registerCommands creates the commands of the bot in the discord server with the given guild ID and deletes all
+// commands which do not exist anymore.
+func (a *discordApp) registerCommands(guild string) error {
+	cmds, err := a.session.ApplicationCommands(a.session.State.User.ID, guild)
 	if err != nil {
-		a.logger.Error("save-config", err)
+		return err
+	}
+	for _, command := range cmds {
+		if !containsCommand(a.commands, command.Name) {
+			if err := a.session.ApplicationCommandDelete(a.session.State.User.ID, guild, command.ID); err != nil {
+				a.logger.Error("delete-command", "error", err, "name", command.Name, "guild", guild)
+			}
+		}
+	}
+
+	for _, v := range a.commands {
+		if containsCommand(cmds, v.Name) {
+			continue
+		}
+		_, err := a.session.ApplicationCommandCreate(a.session.State.User.ID, guild, v)
+		if err != nil {
+			a.logger.Error("create-command", "error", err, "command", v.Name, "guild", guild)
+		}
+	}
+	return nil
+}
+
+// allowed checks if the member is allowed to use the command based on the configured permissions.
+func (a *discordApp) allowed(name string, h internal.Command, m *discordgo.Member) bool {
+	if m == nil {
+		return false
+	}
+	category := internal.PermissionRead
+	if c, ok := h.(internal.Categorized); ok {
+		category = c.Category()
+	}
+	return a.config.Load().Permissions.Allowed(name, category, m.Roles)
+}
+
+func (a *discordApp) error(s *discordgo.Session, i *discordgo.Interaction, msg string) {
+	if err := ephemeral(s, i, msg); err != nil {
+		a.logger.Error("respond-error", "error", err)
 	}
 }
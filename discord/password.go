@@ -0,0 +1,78 @@
+package discord
+
+import (
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+)
+
+// ServerState provides the last polled information of the configured servers.
+type ServerState interface {
+	// ServerPassword returns the last polled server name and password of the server with the given configured name.
+	// ok is false if the server was not polled successfully yet.
+	ServerPassword(name string) (serverName, password string, ok bool)
+}
+
+type passwordCommand struct {
+	logger *slog.Logger
+	config *atomic.Pointer[internal.Config]
+	state  ServerState
+}
+
+func (c *passwordCommand) Definition(cmd string) *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        cmd,
+		Description: "Shows the current name and password of a server",
+		Options: []*discordgo.ApplicationCommandOption{
+			serverOption("The server to show the password for"),
+		},
+	}
+}
+
+func (c *passwordCommand) OnAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := serverAutocomplete(c.config.Load(), s, i); err != nil {
+		c.logger.Error("autocomplete", "command", "password", "error", err)
+	}
+}
+
+func (c *passwordCommand) OnCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	server, ok := selectedServer(c.config.Load(), i)
+	if !ok {
+		_ = ephemeral(s, i.Interaction, "Unknown server, please select one of the suggested servers.")
+		return
+	}
+	if i.Member == nil || !server.PasswordAllowed(i.Member.Roles) {
+		_ = ephemeral(s, i.Interaction, "The password of "+server.Name+" is only available to the roles configured in its password_roles.")
+		return
+	}
+	name, pw, ok := c.state.ServerPassword(server.Name)
+	if !ok {
+		_ = ephemeral(s, i.Interaction, "There is no information about "+server.Name+" yet, please try again later.")
+		return
+	}
+	if pw == "" {
+		pw = "_no password_"
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{{
+				Title: server.Name,
+				Color: serverColor(server),
+				Fields: []*discordgo.MessageEmbedField{{
+					Name:  "Server Name",
+					Value: name,
+				}, {
+					Name:  "Password",
+					Value: pw,
+				}},
+			}},
+		},
+	})
+	if err != nil {
+		c.logger.Error("respond", "command", "password", "error", err)
+	}
+}
@@ -0,0 +1,136 @@
+package discord
+
+import (
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+)
+
+const (
+	restartConfirmPrefix = "restart/confirm/"
+	restartCancelPrefix  = "restart/cancel/"
+)
+
+// ServerRestarter restarts servers through their control panel.
+type ServerRestarter interface {
+	// Restart restarts the server with the given configured name and returns the status reported by the control panel.
+	Restart(name string) (string, error)
+}
+
+type restartCommand struct {
+	logger    *slog.Logger
+	config    *atomic.Pointer[internal.Config]
+	restarter ServerRestarter
+}
+
+func (c *restartCommand) Definition(cmd string) *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        cmd,
+		Description: "Restarts a server through the control panel",
+		Options: []*discordgo.ApplicationCommandOption{
+			serverOption("The server to restart"),
+		},
+	}
+}
+
+func (c *restartCommand) Category() string {
+	return internal.PermissionRestart
+}
+
+func (c *restartCommand) OnAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := serverAutocomplete(c.config.Load(), s, i); err != nil {
+		c.logger.Error("autocomplete", "command", "restart", "error", err)
+	}
+}
+
+func (c *restartCommand) OnCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	server, ok := selectedServer(c.config.Load(), i)
+	if !ok {
+		_ = ephemeral(s, i.Interaction, "Unknown server, please select one of the suggested servers.")
+		return
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "Do you really want to restart " + server.Name + "? All players will be disconnected.",
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						CustomID: restartConfirmPrefix + server.Name,
+						Label:    "Confirm",
+						Style:    discordgo.DangerButton,
+					},
+					discordgo.Button{
+						CustomID: restartCancelPrefix + server.Name,
+						Label:    "Cancel",
+						Style:    discordgo.SecondaryButton,
+					},
+				}},
+			},
+		},
+	})
+	if err != nil {
+		c.logger.Error("respond", "command", "restart", "error", err)
+	}
+}
+
+func (c *restartCommand) CanHandle(customId string) bool {
+	return strings.HasPrefix(customId, restartConfirmPrefix) || strings.HasPrefix(customId, restartCancelPrefix)
+}
+
+func (c *restartCommand) OnMessageComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	cid := i.MessageComponentData().CustomID
+	if strings.HasPrefix(cid, restartCancelPrefix) {
+		c.update(s, i, "Restart of "+strings.TrimPrefix(cid, restartCancelPrefix)+" cancelled.")
+		return
+	}
+
+	server, ok := findServer(c.config.Load(), i.GuildID, strings.TrimPrefix(cid, restartConfirmPrefix))
+	if !ok {
+		c.update(s, i, "The server does not exist anymore.")
+		return
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		c.logger.Error("respond", "command", "restart", "error", err)
+		return
+	}
+
+	msg := "Restarted " + server.Name + "."
+	status, err := c.restarter.Restart(server.Name)
+	if err != nil {
+		c.logger.Error("restart", "server", server.Name, "error", err)
+		msg = "Could not restart " + server.Name + ": " + err.Error()
+	} else {
+		c.logger.Info("restart", "server", server.Name, "user", interactionUser(i), "status", status)
+		if status != "" {
+			msg = "Restarted " + server.Name + ": " + status
+		}
+	}
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:    &msg,
+		Components: &[]discordgo.MessageComponent{},
+	})
+	if err != nil {
+		c.logger.Error("respond", "command", "restart", "error", err)
+	}
+}
+
+func (c *restartCommand) update(s *discordgo.Session, i *discordgo.InteractionCreate, msg string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    msg,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		c.logger.Error("respond", "command", "restart", "error", err)
+	}
+}
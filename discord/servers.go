@@ -0,0 +1,97 @@
+package discord
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+)
+
+const (
+	serverOptionName = "server"
+	// maxChoices is the maximum number of choices discord accepts in an autocomplete response
+	maxChoices = 25
+)
+
+func serverOption(description string) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         serverOptionName,
+		Description:  description,
+		Required:     true,
+		Autocomplete: true,
+	}
+}
+
+// findServer returns the server with the given name, if it is available in the discord server with the given guild ID.
+func findServer(c *internal.Config, guild, name string) (internal.Server, bool) {
+	for _, server := range c.Servers {
+		if server.Name == name && c.Guild(server) == guild {
+			return server, true
+		}
+	}
+	return internal.Server{}, false
+}
+
+func serverColor(server internal.Server) int {
+	if server.Color != nil {
+		return *server.Color
+	}
+	return internal.ColorDarkGrey
+}
+
+func selectedServer(c *internal.Config, i *discordgo.InteractionCreate) (internal.Server, bool) {
+	o := i.ApplicationCommandData().GetOption(serverOptionName)
+	if o == nil {
+		return internal.Server{}, false
+	}
+	return findServer(c, i.GuildID, o.StringValue())
+}
+
+// serverAutocomplete responds to an autocomplete interaction with all servers of the discord server matching the
+// currently entered value of the server option.
+func serverAutocomplete(c *internal.Config, s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	var value string
+	if o := i.ApplicationCommandData().GetOption(serverOptionName); o != nil && o.Focused {
+		value = strings.ToLower(o.StringValue())
+	}
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, server := range c.Servers {
+		if len(choices) == maxChoices {
+			break
+		}
+		if c.Guild(server) != i.GuildID || !strings.Contains(strings.ToLower(server.Name), value) {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  server.Name,
+			Value: server.Name,
+		})
+	}
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+}
+
+func ephemeral(s *discordgo.Session, i *discordgo.Interaction, msg string) error {
+	return s.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: msg,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+func interactionUser(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
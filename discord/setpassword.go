@@ -0,0 +1,146 @@
+package discord
+
+import (
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+)
+
+const (
+	setPasswordModalPrefix = "setpassword/"
+	serverNameInput        = "server_name"
+	passwordInput          = "password"
+)
+
+// ServerConfigurer writes server information back to the control panel of a server.
+type ServerConfigurer interface {
+	// SetServerInfo sets the server name and password of the server with the given configured name. The new
+	// information are published to discord after they were set successfully.
+	SetServerInfo(name, serverName, password string) error
+}
+
+type setPasswordCommand struct {
+	logger     *slog.Logger
+	config     *atomic.Pointer[internal.Config]
+	state      ServerState
+	configurer ServerConfigurer
+}
+
+func (c *setPasswordCommand) Definition(cmd string) *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:        cmd,
+		Description: "Changes the name and password of a server in the control panel",
+		Options: []*discordgo.ApplicationCommandOption{
+			serverOption("The server to change the password of"),
+		},
+	}
+}
+
+func (c *setPasswordCommand) Category() string {
+	return internal.PermissionWrite
+}
+
+func (c *setPasswordCommand) OnAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := serverAutocomplete(c.config.Load(), s, i); err != nil {
+		c.logger.Error("autocomplete", "command", "setpassword", "error", err)
+	}
+}
+
+func (c *setPasswordCommand) OnCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	server, ok := selectedServer(c.config.Load(), i)
+	if !ok {
+		_ = ephemeral(s, i.Interaction, "Unknown server, please select one of the suggested servers.")
+		return
+	}
+	if server.Hoster != nil && *server.Hoster == "streamline" {
+		_ = ephemeral(s, i.Interaction, "Changing the password is not supported for servers hosted by Streamline.")
+		return
+	}
+	name, pw, _ := c.state.ServerPassword(server.Name)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: setPasswordModalPrefix + server.Name,
+			Title:    "Change password",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.TextInput{
+						CustomID:  serverNameInput,
+						Label:     "Server Name",
+						Style:     discordgo.TextInputShort,
+						Value:     name,
+						Required:  true,
+						MaxLength: 100,
+					},
+				}},
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.TextInput{
+						CustomID:    passwordInput,
+						Label:       "Password",
+						Style:       discordgo.TextInputShort,
+						Placeholder: "Leave empty to remove the password",
+						Value:       pw,
+						MaxLength:   100,
+					},
+				}},
+			},
+		},
+	})
+	if err != nil {
+		c.logger.Error("respond", "command", "setpassword", "error", err)
+	}
+}
+
+func (c *setPasswordCommand) CanHandle(customId string) bool {
+	return strings.HasPrefix(customId, setPasswordModalPrefix)
+}
+
+func (c *setPasswordCommand) OnModalSubmit(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ModalSubmitData()
+	server, ok := findServer(c.config.Load(), i.GuildID, strings.TrimPrefix(data.CustomID, setPasswordModalPrefix))
+	if !ok {
+		_ = ephemeral(s, i.Interaction, "The server does not exist anymore.")
+		return
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		c.logger.Error("respond", "command", "setpassword", "error", err)
+		return
+	}
+
+	name := textInputValue(data.Components, serverNameInput)
+	pw := textInputValue(data.Components, passwordInput)
+	msg := "Changed the password of " + server.Name + ", the status message will be updated shortly."
+	if err := c.configurer.SetServerInfo(server.Name, name, pw); err != nil {
+		c.logger.Error("set-server-info", "server", server.Name, "error", err)
+		msg = "Could not change the password of " + server.Name + ": " + err.Error()
+	} else {
+		c.logger.Info("set-server-info", "server", server.Name, "user", interactionUser(i))
+	}
+	if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &msg}); err != nil {
+		c.logger.Error("respond", "command", "setpassword", "error", err)
+	}
+}
+
+func textInputValue(components []discordgo.MessageComponent, customId string) string {
+	for _, c := range components {
+		row, ok := c.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, rc := range row.Components {
+			if input, ok := rc.(*discordgo.TextInput); ok && input.CustomID == customId {
+				return input.Value
+			}
+		}
+	}
+	return ""
+}
@@ -5,12 +5,12 @@ go 1.26
 require (
 	github.com/bwmarrin/discordgo v0.29.0
 	github.com/floriansw/go-tcadmin v0.0.0-20260217215940-f7d9d4c0f9c1
+	github.com/fsnotify/fsnotify v1.10.1
 	github.com/onsi/ginkgo v1.16.5
 	github.com/onsi/gomega v1.41.0
 )
 
 require (
-	github.com/fsnotify/fsnotify v1.10.1 // indirect
 	github.com/google/go-cmp v0.7.0 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/kr/text v0.2.0 // indirect
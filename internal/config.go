@@ -4,13 +4,46 @@ import (
 	"encoding/json"
 	"log/slog"
 	"os"
+	"slices"
+)
+
+const (
+	// PermissionRead is the permission category of commands which only show information
+	PermissionRead = "read"
+	// PermissionWrite is the permission category of commands which change the configuration of a server
+	PermissionWrite = "write"
+	// PermissionRestart is the permission category of commands which restart a server
+	PermissionRestart = "restart"
+
+	// MessageModeCombined publishes the status of all servers together in as few messages as possible
+	MessageModeCombined = "combined"
+	// MessageModePerServer publishes the status of each server in its own message
+	MessageModePerServer = "per_server"
 )
 
 type Discord struct {
-	Token     string  `json:"token"`
-	GuildId   string  `json:"guild"`
-	ChannelId string  `json:"channel_id"`
-	MessageId *string `json:"message_id"`
+	// Token is the bot token, or a reference to an environment variable containing it, e.g. ${DISCORD_TOKEN}
+	Token string `json:"token,omitempty"`
+	// TokenFile is the path of a file containing the bot token, e.g. a docker secret, instead of Token
+	TokenFile string `json:"token_file,omitempty"`
+	GuildId   string `json:"guild"`
+	ChannelId string `json:"channel_id"`
+	// MessageId is the ID of the single status message of previous versions, it is migrated to the State on the first
+	// start.
+	//
+	// Deprecated: The messages are stored in the State.
+	MessageId *string `json:"message_id,omitempty"`
+	// MessageMode is either MessageModeCombined (default) or MessageModePerServer
+	MessageMode string `json:"message_mode,omitempty"`
+	// AdminChannelId is the ID of the channel in which admins are alerted about problems which need their attention
+	AdminChannelId *string `json:"admin_channel_id,omitempty"`
+}
+
+// Webhook is a discord webhook the status is published to in addition to, or instead of, the bot.
+type Webhook struct {
+	Url string `json:"url"`
+	// Servers are the names of the servers published through the webhook, all servers are published if it is empty
+	Servers []string `json:"servers,omitempty"`
 }
 
 type Config struct {
@@ -18,6 +51,12 @@ type Config struct {
 	Servers             []Server `json:"servers"`
 	PollIntervalSeconds *int     `json:"poll_interval_seconds"`
 	ControlPanelBaseUrl string   `json:"control_panel_base_url"`
+	// PollConcurrency is the maximum number of servers which are polled at the same time
+	PollConcurrency *int `json:"poll_concurrency,omitempty"`
+	// Permissions maps command names or permission categories to the discord role IDs allowed to use them
+	Permissions Permissions `json:"permissions,omitempty"`
+	// Webhooks are discord webhooks the status of the servers is published to, which does not require a bot
+	Webhooks []Webhook `json:"webhooks,omitempty"`
 
 	path string
 }
@@ -30,28 +69,120 @@ type Server struct {
 	Color               *int        `json:"color"`
 	ServiceId           string      `json:"service_id"`
 	Credentials         Credentials `json:"credentials"`
+	// TimeoutSeconds is the maximum duration of a single query to the control panel of the server
+	TimeoutSeconds *int `json:"timeout_seconds,omitempty"`
+	// NotifyRole is the ID of the discord role which is mentioned when the server name or password changed
+	NotifyRole *string `json:"notify_role,omitempty"`
+	// PasswordRoles are the IDs of the discord roles which are allowed to see the password of the server with the
+	// commands of the bot, e.g. for a members-only server. Defaults to everyone allowed to use the command.
+	PasswordRoles []string `json:"password_roles,omitempty"`
+	// Discord overrides where the status of the server is published
+	Discord *ServerDiscord `json:"discord,omitempty"`
 }
 
+// ServerDiscord configures a different discord channel, and optionally discord server, for a single server.
+type ServerDiscord struct {
+	ChannelId string `json:"channel_id"`
+	// GuildId is the discord server of the channel. The commands of the bot are registered in this discord server, too.
+	// Defaults to the guild of the Discord config.
+	GuildId *string `json:"guild,omitempty"`
+}
+
+// Credentials are the login of a server in its control panel. Username and Password may contain references to
+// environment variables like ${PANEL_PASSWORD}, use Resolve to get the actual values.
 type Credentials struct {
 	Username string `json:"username"`
-	Password string `json:"password"`
+	Password string `json:"password,omitempty"`
+	// PasswordFile is the path of a file containing the password, e.g. a docker secret, instead of Password
+	PasswordFile string `json:"password_file,omitempty"`
+}
+
+// Permissions maps command names or permission categories (PermissionRead, PermissionWrite, PermissionRestart) to
+// the discord role IDs which are allowed to use the command or all commands of the category.
+type Permissions map[string][]string
+
+// Allowed returns true if a member with the given roles is allowed to use the command with the given name and
+// permission category. Roles configured for the command name take precedence over the roles of the category. Commands
+// without any configured roles are allowed for everyone, if they are in the PermissionRead category, and denied
+// otherwise.
+func (p Permissions) Allowed(command, category string, roles []string) bool {
+	allowed, ok := p[command]
+	if !ok {
+		allowed, ok = p[category]
+	}
+	if !ok {
+		return category == PermissionRead
+	}
+	for _, role := range roles {
+		if slices.Contains(allowed, role) {
+			return true
+		}
+	}
+	return false
 }
 
+// PasswordAllowed returns true if a member with the given roles is allowed to see the password of the server, see
+// PasswordRoles.
+func (s Server) PasswordAllowed(roles []string) bool {
+	if len(s.PasswordRoles) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		if slices.Contains(s.PasswordRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Channel returns the ID of the discord channel the status of the server is published to.
+func (c *Config) Channel(s Server) string {
+	if s.Discord != nil && s.Discord.ChannelId != "" {
+		return s.Discord.ChannelId
+	}
+	if c.Discord == nil {
+		return ""
+	}
+	return c.Discord.ChannelId
+}
+
+// Guild returns the ID of the discord server, in which the commands of the bot can be used for the server.
+func (c *Config) Guild(s Server) string {
+	if s.Discord != nil && s.Discord.GuildId != nil {
+		return *s.Discord.GuildId
+	}
+	if c.Discord == nil {
+		return ""
+	}
+	return c.Discord.GuildId
+}
+
+// Guilds returns the IDs of all discord servers the bot is used in.
+func (c *Config) Guilds() []string {
+	var guilds []string
+	if c.Discord != nil {
+		guilds = append(guilds, c.Discord.GuildId)
+	}
+	for _, s := range c.Servers {
+		if g := c.Guild(s); !slices.Contains(guilds, g) {
+			guilds = append(guilds, g)
+		}
+	}
+	return guilds
+}
+
+// Save writes the config to the file it was read from. The application itself never saves the config, runtime
+// information is persisted in the State instead. References to secrets are written as they are, without expanding them.
 func (c *Config) Save() error {
 	config, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(c.path, config, 0655)
+	return os.WriteFile(c.path, config, 0600)
 }
 
 func NewConfig(path string, logger *slog.Logger) (*Config, error) {
-	config, err := readConfig(path, logger)
-	if err != nil {
-		return config, err
-	}
-
-	return config, config.Save()
+	return readConfig(path, logger)
 }
 
 func readConfig(path string, logger *slog.Logger) (*Config, error) {
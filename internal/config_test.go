@@ -29,4 +29,67 @@ var _ = Describe("Config", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 	})
+
+	Describe("Permissions", func() {
+		p := internal.Permissions{
+			"setpassword":            {"event-organiser"},
+			internal.PermissionWrite: {"admin"},
+		}
+
+		It("allows read commands without configured roles for everyone", func() {
+			Expect(p.Allowed("password", internal.PermissionRead, nil)).To(BeTrue())
+		})
+
+		It("denies commands of other categories without configured roles", func() {
+			Expect(p.Allowed("restart", internal.PermissionRestart, []string{"admin"})).To(BeFalse())
+		})
+
+		It("allows members with a role of the category", func() {
+			Expect(p.Allowed("othercommand", internal.PermissionWrite, []string{"member", "admin"})).To(BeTrue())
+		})
+
+		It("prefers roles configured for the command over the category", func() {
+			Expect(p.Allowed("setpassword", internal.PermissionWrite, []string{"event-organiser"})).To(BeTrue())
+			Expect(p.Allowed("setpassword", internal.PermissionWrite, []string{"admin"})).To(BeFalse())
+		})
+
+		It("restricts read commands with configured roles", func() {
+			p := internal.Permissions{internal.PermissionRead: {"member"}}
+			Expect(p.Allowed("password", internal.PermissionRead, []string{"guest"})).To(BeFalse())
+			Expect(p.Allowed("password", internal.PermissionRead, []string{"member"})).To(BeTrue())
+		})
+	})
+	Describe("Destinations", func() {
+		partner := "partner-guild"
+		c := &internal.Config{
+			Discord: &internal.Discord{GuildId: "clan-guild", ChannelId: "public"},
+			Servers: []internal.Server{
+				{Name: "event", Discord: &internal.ServerDiscord{ChannelId: "partners", GuildId: &partner}},
+				{Name: "training", Discord: &internal.ServerDiscord{ChannelId: "members"}},
+				{Name: "public"},
+			},
+		}
+
+		It("uses the channel of the server", func() {
+			Expect(c.Channel(c.Servers[0])).To(Equal("partners"))
+			Expect(c.Channel(c.Servers[1])).To(Equal("members"))
+			Expect(c.Channel(c.Servers[2])).To(Equal("public"))
+		})
+
+		It("uses the guild of the server", func() {
+			Expect(c.Guild(c.Servers[0])).To(Equal("partner-guild"))
+			Expect(c.Guild(c.Servers[1])).To(Equal("clan-guild"))
+		})
+
+		It("shows the password to everyone, unless password roles are configured", func() {
+			training := internal.Server{Name: "training", PasswordRoles: []string{"member"}}
+			Expect(c.Servers[0].PasswordAllowed(nil)).To(BeTrue())
+			Expect(training.PasswordAllowed([]string{"guest"})).To(BeFalse())
+			Expect(training.PasswordAllowed([]string{"guest", "member"})).To(BeTrue())
+		})
+
+		It("returns every guild once", func() {
+			Expect(c.Guilds()).To(Equal([]string{"clan-guild", "partner-guild"}))
+		})
+	})
 })
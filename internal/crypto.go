@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// KeyEnv is the environment variable containing the key, which encrypts the secrets in the config. The key is 32
+	// random bytes encoded with base64, e.g. generated with openssl rand -base64 32.
+	KeyEnv = "HLL_WATCHER_KEY"
+	// KeyFileEnv is the environment variable containing the path of a file with the key, as an alternative to KeyEnv
+	KeyFileEnv = "HLL_WATCHER_KEY_FILE"
+
+	// encryptedPrefix marks encrypted values in the config
+	encryptedPrefix = "enc:"
+)
+
+var errNoKey = errors.New("no key to decrypt the config is configured, set " + KeyEnv + " or " + KeyFileEnv)
+
+// EncryptSecrets encrypts the passwords of all servers and the bot token with the key from the environment. Values
+// which reference an environment variable or a file, as well as values which are encrypted already, are kept as they
+// are. It returns the number of values which were encrypted.
+func (c *Config) EncryptSecrets() (int, error) {
+	key, err := encryptionKey()
+	if err != nil {
+		return 0, err
+	}
+	var secrets []*string
+	if c.Discord != nil {
+		secrets = append(secrets, &c.Discord.Token)
+	}
+	for idx := range c.Servers {
+		secrets = append(secrets, &c.Servers[idx].Credentials.Password)
+	}
+	count := 0
+	for _, s := range secrets {
+		if *s == "" || isEncrypted(*s) || envReference.MatchString(*s) {
+			continue
+		}
+		v, err := encrypt(key, *s)
+		if err != nil {
+			return count, err
+		}
+		*s = v
+		count++
+	}
+	return count, nil
+}
+
+// encryptionKey reads the key from the environment.
+func encryptionKey() ([]byte, error) {
+	encoded, ok := os.LookupEnv(KeyEnv)
+	if file, fok := os.LookupEnv(KeyFileEnv); !ok && fok {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read key file: %w", err)
+		}
+		encoded, ok = string(b), true
+	}
+	if !ok {
+		return nil, errNoKey
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("the key is not encoded with base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("the key must be 32 bytes long, got %d bytes", len(key))
+	}
+	return key, nil
+}
+
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// encrypt encrypts value with AES-GCM and returns it base64 encoded, together with its nonce and the encryptedPrefix.
+func encrypt(key []byte, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt reverses encrypt.
+func decrypt(key []byte, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errors.New("the encrypted value is malformed")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("the value could not be decrypted, it was encrypted with a different key")
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
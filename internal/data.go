@@ -9,6 +9,13 @@ type Command interface {
 	OnCommand(s *discordgo.Session, i *discordgo.InteractionCreate)
 }
 
+// Categorized is implemented by commands which are not in the PermissionRead category.
+type Categorized interface {
+	// Category returns the permission category of the command, one of PermissionRead, PermissionWrite or
+	// PermissionRestart.
+	Category() string
+}
+
 type Autocomplete interface {
 	OnAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate)
 }
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay is the time waited after the last change of the config file before it is read, as editors usually
+// write a file in multiple steps.
+const reloadDelay = 500 * time.Millisecond
+
+// ConfigWatcher reads the config again whenever its file changed.
+type ConfigWatcher struct {
+	logger   *slog.Logger
+	path     string
+	fw       *fsnotify.Watcher
+	onChange func(c *Config) error
+	done     chan struct{}
+
+	content []byte
+}
+
+// WatchConfig watches the config file at path and calls onChange with the new config, whenever the file changed and
+// the new config is valid. Invalid configs, as well as configs onChange returns an error for, are logged and ignored.
+// The previous config stays active in this case.
+func WatchConfig(path string, logger *slog.Logger, onChange func(c *Config) error) (*ConfigWatcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		_ = fw.Close()
+		return nil, err
+	}
+	// The directory is watched to notice when editors replace the file, the file itself is watched to notice changes
+	// of a file which is mounted into a container.
+	for _, p := range []string{filepath.Dir(path), path} {
+		if err := fw.Add(p); err != nil {
+			_ = fw.Close()
+			return nil, err
+		}
+	}
+	w := &ConfigWatcher{
+		logger:   logger,
+		path:     filepath.Clean(path),
+		fw:       fw,
+		onChange: onChange,
+		done:     make(chan struct{}),
+		content:  content,
+	}
+	go w.watch()
+	return w, nil
+}
+
+// Close stops watching the config file.
+func (w *ConfigWatcher) Close() error {
+	err := w.fw.Close()
+	<-w.done
+	return err
+}
+
+func (w *ConfigWatcher) watch() {
+	defer close(w.done)
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case e, ok := <-w.fw.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(e.Name) != w.path {
+				continue
+			}
+			if e.Has(fsnotify.Create) {
+				// the file was replaced, hence the watch of the previous file is gone
+				if err := w.fw.Add(w.path); err != nil {
+					w.logger.Error("watch-config", "error", err)
+				}
+			}
+			timer.Reset(reloadDelay)
+		case err, ok := <-w.fw.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Error("watch-config", "error", err)
+		case <-timer.C:
+			w.reload()
+		}
+	}
+}
+
+func (w *ConfigWatcher) reload() {
+	content, err := os.ReadFile(w.path)
+	if err != nil {
+		w.logger.Error("reload-config", "error", err)
+		return
+	}
+	if bytes.Equal(content, w.content) {
+		return
+	}
+	c, err := readConfig(w.path, w.logger)
+	if err == nil {
+		err = c.Validate()
+	}
+	if err == nil {
+		err = w.onChange(c)
+	}
+	if err != nil {
+		w.logger.Error("reload-config", "reason", "keeping the previous config", "error", err)
+		return
+	}
+	w.content = content
+	w.logger.Info("reload-config")
+}
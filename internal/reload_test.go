@@ -0,0 +1,98 @@
+package internal_test
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WatchConfig", func() {
+	l := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	var dir, path string
+	var changes chan *internal.Config
+	var w *internal.ConfigWatcher
+	var reject atomic.Bool
+	config := func(names ...string) []byte {
+		c := internal.Config{
+			Webhooks:            []internal.Webhook{{Url: "https://discord.com/api/webhooks/1/token"}},
+			ControlPanelBaseUrl: "qp.qonzer.com",
+		}
+		for _, name := range names {
+			c.Servers = append(c.Servers, internal.Server{
+				Name:        name,
+				ServiceId:   name,
+				Credentials: internal.Credentials{Username: "user", Password: "password"},
+			})
+		}
+		b, err := json.Marshal(c)
+		Expect(err).ToNot(HaveOccurred())
+		return b
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp(os.TempDir(), "reload")
+		Expect(err).ToNot(HaveOccurred())
+		path = filepath.Join(dir, "config.json")
+		Expect(os.WriteFile(path, config("A"), 0644)).To(Succeed())
+		changes = make(chan *internal.Config, 10)
+		reject.Store(false)
+		w, err = internal.WatchConfig(path, l, func(c *internal.Config) error {
+			changes <- c
+			if reject.Load() {
+				return errors.New("restart required")
+			}
+			return nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(w.Close()).To(Succeed())
+		_ = os.RemoveAll(dir)
+	})
+
+	It("reads the config again after it changed", func() {
+		Expect(os.WriteFile(path, config("A", "B"), 0644)).To(Succeed())
+
+		var c *internal.Config
+		Eventually(changes, 2*time.Second).Should(Receive(&c))
+		Expect(c.Servers).To(HaveLen(2))
+	})
+
+	It("notices configs replaced by a rename", func() {
+		tmp := filepath.Join(dir, "config.json.tmp")
+		Expect(os.WriteFile(tmp, config("B"), 0644)).To(Succeed())
+		Expect(os.Rename(tmp, path)).To(Succeed())
+
+		var c *internal.Config
+		Eventually(changes, 2*time.Second).Should(Receive(&c))
+		Expect(c.Servers[0].Name).To(Equal("B"))
+	})
+
+	It("ignores invalid configs", func() {
+		Expect(os.WriteFile(path, config("A", "A"), 0644)).To(Succeed())
+		Consistently(changes, time.Second).ShouldNot(Receive())
+
+		Expect(os.WriteFile(path, []byte(`{"servers": [`), 0644)).To(Succeed())
+		Consistently(changes, time.Second).ShouldNot(Receive())
+	})
+
+	It("retries configs which could not be applied", func() {
+		reject.Store(true)
+		Expect(os.WriteFile(path, config("B"), 0644)).To(Succeed())
+		Eventually(changes, 2*time.Second).Should(Receive())
+
+		reject.Store(false)
+		Expect(os.WriteFile(path, config("B"), 0644)).To(Succeed())
+		Eventually(changes, 2*time.Second).Should(Receive())
+	})
+})
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envReference matches references to environment variables in config values, e.g. ${PANEL_PASSWORD}
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)}`)
+
+// Resolve returns the credentials with all references to environment variables expanded and the password read from
+// the PasswordFile or decrypted, if it is configured that way. The credentials of the config itself are not changed,
+// so that the references and encrypted values are preserved when the config is saved.
+func (c Credentials) Resolve() (Credentials, error) {
+	username, err := expandEnv(c.Username)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("username: %w", err)
+	}
+	password, err := resolveSecret(c.Password, c.PasswordFile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("password: %w", err)
+	}
+	return Credentials{Username: username, Password: password}, nil
+}
+
+// ResolveToken returns the bot token with all references to environment variables expanded, read from the TokenFile,
+// or decrypted, if it is configured that way.
+func (d *Discord) ResolveToken() (string, error) {
+	return resolveSecret(d.Token, d.TokenFile)
+}
+
+// resolveSecret returns the content of file, if it is set, the decrypted value, if it is encrypted, and value with all
+// references to environment variables expanded otherwise. Surrounding whitespace, like the trailing newline of a
+// secret file, is removed.
+func resolveSecret(value, file string) (string, error) {
+	if file == "" && isEncrypted(value) {
+		key, err := encryptionKey()
+		if err != nil {
+			return "", err
+		}
+		return decrypt(key, value)
+	}
+	if file == "" {
+		return expandEnv(value)
+	}
+	if value != "" {
+		return "", fmt.Errorf("either the value or a file can be configured, not both")
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// expandEnv replaces all references like ${NAME} in value with the value of the environment variable NAME. Other
+// occurrences of $ are kept as they are, as they might be part of a password.
+func expandEnv(value string) (string, error) {
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) != 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
@@ -0,0 +1,169 @@
+package internal_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Secrets", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp(os.TempDir(), "secrets")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.Setenv("WATCHER_TEST_USER", "user")).To(Succeed())
+		Expect(os.Setenv("WATCHER_TEST_TOKEN", "token")).To(Succeed())
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+		_ = os.Unsetenv("WATCHER_TEST_USER")
+		_ = os.Unsetenv("WATCHER_TEST_TOKEN")
+	})
+
+	It("expands references to environment variables", func() {
+		c, err := internal.Credentials{Username: "${WATCHER_TEST_USER}", Password: "pa$$-${WATCHER_TEST_TOKEN}"}.Resolve()
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(internal.Credentials{Username: "user", Password: "pa$$-token"}))
+	})
+
+	It("fails for missing environment variables", func() {
+		_, err := (&internal.Discord{Token: "${WATCHER_TEST_MISSING}"}).ResolveToken()
+
+		Expect(err).To(MatchError("environment variable WATCHER_TEST_MISSING is not set"))
+	})
+
+	It("reads secrets from files", func() {
+		file := filepath.Join(dir, "password")
+		Expect(os.WriteFile(file, []byte("secret\n"), 0600)).To(Succeed())
+
+		c, err := internal.Credentials{Username: "user", PasswordFile: file}.Resolve()
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Password).To(Equal("secret"))
+	})
+
+	It("rejects a value together with a file", func() {
+		_, err := (&internal.Discord{Token: "token", TokenFile: "token_file"}).ResolveToken()
+
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reports unresolvable secrets in the validation", func() {
+		c := validConfig()
+		c.Discord.Token = "${WATCHER_TEST_MISSING}"
+		c.Servers[0].Credentials = internal.Credentials{Username: "user", PasswordFile: filepath.Join(dir, "missing")}
+
+		paths := []string{}
+		for _, p := range problems(c.Validate()) {
+			paths = append(paths, p.Path)
+		}
+		Expect(paths).To(ConsistOf("discord.token", "servers[0].credentials.password_file"))
+	})
+
+	It("preserves the references when saving the config", func() {
+		path := filepath.Join(dir, "config.json")
+		Expect(os.WriteFile(path, []byte(`{
+			"discord": {"token_file": "/run/secrets/token"},
+			"servers": [{"name": "A", "credentials": {"username": "${WATCHER_TEST_USER}", "password": "${WATCHER_TEST_TOKEN}"}}]
+		}`), 0600)).To(Succeed())
+		c, err := internal.NewConfig(path, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(c.Save()).To(Succeed())
+
+		b, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring(`"token_file": "/run/secrets/token"`))
+		Expect(string(b)).To(ContainSubstring(`"username": "${WATCHER_TEST_USER}"`))
+		Expect(string(b)).To(ContainSubstring(`"password": "${WATCHER_TEST_TOKEN}"`))
+		Expect(string(b)).ToNot(ContainSubstring(`"token"`))
+	})
+
+	Describe("encryption", func() {
+		var path string
+
+		BeforeEach(func() {
+			key := make([]byte, 32)
+			_, _ = rand.Read(key)
+			Expect(os.Setenv(internal.KeyEnv, base64.StdEncoding.EncodeToString(key))).To(Succeed())
+			path = filepath.Join(dir, "config.json")
+			Expect(os.WriteFile(path, []byte(`{
+				"discord": {"token": "token"},
+				"servers": [
+					{"name": "A", "credentials": {"username": "user", "password": "secret"}},
+					{"name": "B", "credentials": {"username": "user", "password": "${WATCHER_TEST_TOKEN}"}}
+				]
+			}`), 0600)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			_ = os.Unsetenv(internal.KeyEnv)
+		})
+
+		It("encrypts plaintext secrets and decrypts them transparently", func() {
+			c, err := internal.NewConfig(path, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+			Expect(err).ToNot(HaveOccurred())
+
+			count, err := c.EncryptSecrets()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(2))
+			Expect(c.Save()).To(Succeed())
+
+			b, err := os.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).ToNot(ContainSubstring("secret"))
+			Expect(string(b)).To(ContainSubstring(`"password": "${WATCHER_TEST_TOKEN}"`))
+
+			c, err = internal.NewConfig(path, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Discord.Token).To(HavePrefix("enc:"))
+			Expect(c.Discord.ResolveToken()).To(Equal("token"))
+			Expect(c.Servers[0].Credentials.Resolve()).To(Equal(internal.Credentials{Username: "user", Password: "secret"}))
+			Expect(c.Servers[1].Credentials.Resolve()).To(Equal(internal.Credentials{Username: "user", Password: "token"}))
+
+			count, err = c.EncryptSecrets()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(0))
+		})
+
+		It("reads the key from a file", func() {
+			c, err := internal.NewConfig(path, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = c.EncryptSecrets()
+			Expect(err).ToNot(HaveOccurred())
+
+			keyFile := filepath.Join(dir, "key")
+			Expect(os.WriteFile(keyFile, []byte(os.Getenv(internal.KeyEnv)+"\n"), 0600)).To(Succeed())
+			Expect(os.Unsetenv(internal.KeyEnv)).To(Succeed())
+			Expect(os.Setenv(internal.KeyFileEnv, keyFile)).To(Succeed())
+			defer os.Unsetenv(internal.KeyFileEnv)
+
+			Expect(c.Discord.ResolveToken()).To(Equal("token"))
+		})
+
+		It("fails to decrypt with a different or missing key", func() {
+			c, err := internal.NewConfig(path, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = c.EncryptSecrets()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(os.Setenv(internal.KeyEnv, base64.StdEncoding.EncodeToString(make([]byte, 32)))).To(Succeed())
+			_, err = c.Discord.ResolveToken()
+			Expect(err).To(HaveOccurred())
+
+			Expect(os.Unsetenv(internal.KeyEnv)).To(Succeed())
+			_, err = c.Servers[0].Credentials.Resolve()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
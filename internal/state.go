@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// State is the runtime state of the application, like the IDs of the published messages and the last known values of
+// the servers. The config is never written by the application, hence the state is persisted in its own file whenever
+// it changes. State is safe for concurrent use.
+type State struct {
+	mu   sync.Mutex
+	path string
+	data stateData
+}
+
+type stateData struct {
+	// Messages are the status messages of the MessageModeCombined, in the order of the servers they show
+	Messages []Message `json:"messages,omitempty"`
+	// ServerMessages are the status messages of the MessageModePerServer by the name of the server they show
+	ServerMessages map[string]Message `json:"server_messages,omitempty"`
+	// Webhooks are the messages executed through each webhook by the URL of the webhook
+	Webhooks map[string][]Message `json:"webhooks,omitempty"`
+	// LastKnown are the values of the last successful poll by the name of the server
+	LastKnown map[string]LastKnown `json:"last_known,omitempty"`
+}
+
+// Message is a discord message managed by the watcher.
+type Message struct {
+	Id string `json:"id"`
+	// ChannelId is the ID of the channel the message was posted in, empty for the channel of the Discord config
+	ChannelId string `json:"channel_id,omitempty"`
+	// Fingerprint identifies the content of the message when it was published last
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// LastKnown are the values of a server at its last successful poll.
+type LastKnown struct {
+	ServerName     string    `json:"server_name"`
+	ServerPassword string    `json:"server_password"`
+	LastSuccess    time.Time `json:"last_success"`
+}
+
+// NewState reads the state from the file at path. If the file does not exist yet, it is created with the ID of the
+// status message previous versions stored in the config c.
+func NewState(path string, c *Config, logger *slog.Logger) (*State, error) {
+	s := &State{path: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Info("create-state")
+		s.migrate(c)
+		return s, s.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("read-existing-state")
+	return s, json.Unmarshal(b, &s.data)
+}
+
+// migrate takes over the ID of the status message, which was stored in the config by previous versions.
+func (s *State) migrate(c *Config) {
+	if c.Discord != nil && c.Discord.MessageId != nil {
+		s.data.Messages = []Message{{Id: *c.Discord.MessageId}}
+	}
+}
+
+// Messages returns the status messages of the MessageModeCombined.
+func (s *State) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.data.Messages)
+}
+
+func (s *State) SetMessages(m []Message) error {
+	return s.update(func(d *stateData) {
+		d.Messages = m
+	})
+}
+
+// ServerMessages returns the status messages of the MessageModePerServer by the name of the server they show.
+func (s *State) ServerMessages() map[string]Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.data.ServerMessages)
+}
+
+// SetServerMessage sets the status message of the server with the given name, nil removes it.
+func (s *State) SetServerMessage(name string, m *Message) error {
+	return s.update(func(d *stateData) {
+		if m == nil {
+			delete(d.ServerMessages, name)
+			return
+		}
+		if d.ServerMessages == nil {
+			d.ServerMessages = map[string]Message{}
+		}
+		d.ServerMessages[name] = *m
+	})
+}
+
+// RemoveMessages removes the status messages of the bot, for which fn returns true, in both message modes.
+func (s *State) RemoveMessages(fn func(m Message) bool) error {
+	return s.update(func(d *stateData) {
+		d.Messages = slices.DeleteFunc(d.Messages, fn)
+		maps.DeleteFunc(d.ServerMessages, func(_ string, m Message) bool { return fn(m) })
+	})
+}
+
+// WebhookMessages returns the messages executed through the webhook with the given URL.
+func (s *State) WebhookMessages(url string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.data.Webhooks[url])
+}
+
+// WebhookUrls returns the URLs of all webhooks messages were executed through, sorted.
+func (s *State) WebhookUrls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Sorted(maps.Keys(s.data.Webhooks))
+}
+
+func (s *State) SetWebhookMessages(url string, m []Message) error {
+	return s.update(func(d *stateData) {
+		if len(m) == 0 {
+			delete(d.Webhooks, url)
+			return
+		}
+		if d.Webhooks == nil {
+			d.Webhooks = map[string][]Message{}
+		}
+		d.Webhooks[url] = m
+	})
+}
+
+// LastKnown returns the values of the last successful poll by the name of the server.
+func (s *State) LastKnown() map[string]LastKnown {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.data.LastKnown)
+}
+
+func (s *State) SetLastKnown(v map[string]LastKnown) error {
+	return s.update(func(d *stateData) {
+		d.LastKnown = v
+	})
+}
+
+// update applies fn to the state and persists it, if it changed.
+func (s *State) update(fn func(d *stateData)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	fn(&s.data)
+	after, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(before, after) {
+		return nil
+	}
+	return s.save()
+}
+
+func (s *State) save() error {
+	b, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, b, 0600)
+}
+
+// writeFileAtomic writes data into a temporary file next to path and renames it to path afterward. The file at path
+// hence either contains the previous or the new data, even if the application crashes while writing.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,72 @@
+package internal_test
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("State", func() {
+	l := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp(os.TempDir(), "state")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	It("persists changes immediately", func() {
+		path := filepath.Join(dir, "state.json")
+		s, err := internal.NewState(path, &internal.Config{}, l)
+		Expect(err).ToNot(HaveOccurred())
+		now := time.Now().Truncate(time.Second)
+
+		Expect(s.SetMessages([]internal.Message{{Id: "1", Fingerprint: "abc"}})).To(Succeed())
+		Expect(s.SetServerMessage("A", &internal.Message{Id: "2"})).To(Succeed())
+		Expect(s.SetLastKnown(map[string]internal.LastKnown{"A": {ServerName: "Server A", LastSuccess: now}})).To(Succeed())
+
+		s, err = internal.NewState(path, &internal.Config{}, l)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.Messages()).To(Equal([]internal.Message{{Id: "1", Fingerprint: "abc"}}))
+		Expect(s.ServerMessages()).To(HaveKeyWithValue("A", internal.Message{Id: "2"}))
+		Expect(s.LastKnown()["A"].ServerName).To(Equal("Server A"))
+		Expect(s.LastKnown()["A"].LastSuccess.Equal(now)).To(BeTrue())
+		entries, err := os.ReadDir(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("migrates the status message ID stored in the config", func() {
+		path := filepath.Join(dir, "config.json")
+		Expect(os.WriteFile(path, []byte(`{"discord": {"message_id": "1234"}}`), 0600)).To(Succeed())
+		c, err := internal.NewConfig(path, l)
+		Expect(err).ToNot(HaveOccurred())
+
+		s, err := internal.NewState(filepath.Join(dir, "state.json"), c, l)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.Messages()).To(Equal([]internal.Message{{Id: "1234"}}))
+	})
+
+	It("does not write the config", func() {
+		path := filepath.Join(dir, "config.json")
+		Expect(os.WriteFile(path, []byte(`{"servers": []}`), 0644)).To(Succeed())
+
+		_, err := internal.NewConfig(path, l)
+
+		Expect(err).ToNot(HaveOccurred())
+		b, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(Equal(`{"servers": []}`))
+	})
+})
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// maxColor is the largest color discord accepts for embeds
+const maxColor = 0xFFFFFF
+
+// Problem is a single problem of a config.
+type Problem struct {
+	// Path is the JSON path of the value which has the problem, e.g. servers[1].service_id
+	Path    string
+	Message string
+}
+
+// ValidationError contains all problems found in a config.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("the config has %d problem(s):", len(e.Problems)))
+	for _, p := range e.Problems {
+		b.WriteString("\n  " + p.Path + ": " + p.Message)
+	}
+	return b.String()
+}
+
+// Validate checks the config for problems, which would otherwise only surface while the application is running. All
+// problems are returned together as *ValidationError, nil is returned for a valid config.
+func (c *Config) Validate() error {
+	v := &validator{}
+	if c.Discord == nil && len(c.Webhooks) == 0 {
+		v.add("discord", "either the discord bot or at least one webhook needs to be configured")
+	}
+	if d := c.Discord; d != nil {
+		if token, err := d.ResolveToken(); err != nil {
+			v.add(secretPath("discord.token", d.TokenFile), err.Error())
+		} else {
+			v.notEmpty(secretPath("discord.token", d.TokenFile), token)
+		}
+		v.notEmpty("discord.guild", d.GuildId)
+		v.notEmpty("discord.channel_id", d.ChannelId)
+		if d.MessageMode != "" && d.MessageMode != MessageModeCombined && d.MessageMode != MessageModePerServer {
+			v.add("discord.message_mode", fmt.Sprintf("must be %s or %s, got %q", MessageModeCombined, MessageModePerServer, d.MessageMode))
+		}
+		if d.AdminChannelId != nil {
+			v.notEmpty("discord.admin_channel_id", *d.AdminChannelId)
+		}
+	}
+	if c.PollIntervalSeconds != nil && *c.PollIntervalSeconds <= 0 {
+		v.add("poll_interval_seconds", "must be greater than 0")
+	}
+	if c.PollConcurrency != nil && *c.PollConcurrency <= 0 {
+		v.add("poll_concurrency", "must be greater than 0")
+	}
+	if c.ControlPanelBaseUrl != "" {
+		v.baseUrl("control_panel_base_url", c.ControlPanelBaseUrl)
+	}
+
+	if len(c.Servers) == 0 {
+		v.add("servers", "at least one server needs to be configured")
+	}
+	names := map[string]int{}
+	for idx, s := range c.Servers {
+		path := fmt.Sprintf("servers[%d]", idx)
+		if v.notEmpty(path+".name", s.Name) {
+			if other, ok := names[s.Name]; ok {
+				v.add(path+".name", fmt.Sprintf("%q is used by servers[%d] already", s.Name, other))
+			} else {
+				names[s.Name] = idx
+			}
+		}
+		v.notEmpty(path+".service_id", s.ServiceId)
+		v.credentials(path+".credentials", s.Credentials)
+		if s.ControlPanelBaseUrl != nil {
+			v.baseUrl(path+".control_panel_base_url", *s.ControlPanelBaseUrl)
+		} else if c.ControlPanelBaseUrl == "" {
+			v.add(path+".control_panel_base_url", "must be set, either for the server or as control_panel_base_url for all servers")
+		}
+		if s.GameId != nil {
+			v.notEmpty(path+".game_id", *s.GameId)
+		}
+		if s.Color != nil && (*s.Color < 0 || *s.Color > maxColor) {
+			v.add(path+".color", fmt.Sprintf("must be between 0 and %d", maxColor))
+		}
+		if s.TimeoutSeconds != nil && *s.TimeoutSeconds <= 0 {
+			v.add(path+".timeout_seconds", "must be greater than 0")
+		}
+		if s.NotifyRole != nil {
+			v.notEmpty(path+".notify_role", *s.NotifyRole)
+		}
+		for ridx, role := range s.PasswordRoles {
+			v.notEmpty(fmt.Sprintf("%s.password_roles[%d]", path, ridx), role)
+		}
+		if s.Discord != nil {
+			v.notEmpty(path+".discord.channel_id", s.Discord.ChannelId)
+			if s.Discord.GuildId != nil {
+				v.notEmpty(path+".discord.guild", *s.Discord.GuildId)
+			}
+			if c.Discord == nil {
+				v.add(path+".discord", "can only be used together with the discord bot")
+			}
+		}
+	}
+
+	for idx, w := range c.Webhooks {
+		path := fmt.Sprintf("webhooks[%d]", idx)
+		if v.notEmpty(path+".url", w.Url) {
+			u, err := url.Parse(w.Url)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				v.add(path+".url", "must be the URL of a discord webhook, e.g. https://discord.com/api/webhooks/123/abc")
+			}
+		}
+		for sidx, name := range w.Servers {
+			if _, ok := names[name]; !ok {
+				v.add(fmt.Sprintf("%s.servers[%d]", path, sidx), fmt.Sprintf("%q is not the name of a configured server", name))
+			}
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(c.Permissions)) {
+		for idx, role := range c.Permissions[key] {
+			v.notEmpty(fmt.Sprintf("permissions.%s[%d]", key, idx), role)
+		}
+	}
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) add(path, msg string) {
+	v.problems = append(v.problems, Problem{Path: path, Message: msg})
+}
+
+// notEmpty adds a problem if value is empty and returns false in this case.
+func (v *validator) notEmpty(path, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.add(path, "must not be empty")
+		return false
+	}
+	return true
+}
+
+func (v *validator) credentials(path string, c Credentials) {
+	username, err := expandEnv(c.Username)
+	if err != nil {
+		v.add(path+".username", err.Error())
+	} else {
+		v.notEmpty(path+".username", username)
+	}
+	password, err := resolveSecret(c.Password, c.PasswordFile)
+	if err != nil {
+		v.add(secretPath(path+".password", c.PasswordFile), err.Error())
+	} else {
+		v.notEmpty(secretPath(path+".password", c.PasswordFile), password)
+	}
+}
+
+// secretPath returns the path of the file reference of a secret, if a file is configured, and path otherwise.
+func secretPath(path, file string) string {
+	if file != "" {
+		return path + "_file"
+	}
+	return path
+}
+
+func (v *validator) baseUrl(path, value string) {
+	if !v.notEmpty(path, value) {
+		return
+	}
+	if strings.Contains(value, "://") {
+		v.add(path, fmt.Sprintf("must not contain a scheme, e.g. qp.qonzer.com instead of https://qp.qonzer.com, got %q", value))
+	}
+}
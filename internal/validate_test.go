@@ -0,0 +1,88 @@
+package internal_test
+
+import (
+	"errors"
+
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func validConfig() *internal.Config {
+	return &internal.Config{
+		Discord: &internal.Discord{
+			Token:     "token",
+			GuildId:   "guild",
+			ChannelId: "channel",
+		},
+		ControlPanelBaseUrl: "qp.qonzer.com",
+		Servers: []internal.Server{{
+			Name:        "A",
+			ServiceId:   "1",
+			Credentials: internal.Credentials{Username: "user", Password: "password"},
+		}},
+	}
+}
+
+func problems(err error) []internal.Problem {
+	var ve *internal.ValidationError
+	Expect(errors.As(err, &ve)).To(BeTrue())
+	return ve.Problems
+}
+
+var _ = Describe("Validate", func() {
+	It("accepts a valid config", func() {
+		Expect(validConfig().Validate()).To(Succeed())
+	})
+
+	It("reports all problems with their path", func() {
+		c := validConfig()
+		c.Discord.ChannelId = ""
+		c.ControlPanelBaseUrl = ""
+		c.Servers = append(c.Servers, internal.Server{Name: "A"})
+
+		err := c.Validate()
+
+		Expect(problems(err)).To(ConsistOf(
+			internal.Problem{Path: "discord.channel_id", Message: "must not be empty"},
+			internal.Problem{Path: "servers[0].control_panel_base_url", Message: "must be set, either for the server or as control_panel_base_url for all servers"},
+			internal.Problem{Path: "servers[1].name", Message: `"A" is used by servers[0] already`},
+			internal.Problem{Path: "servers[1].service_id", Message: "must not be empty"},
+			internal.Problem{Path: "servers[1].credentials.username", Message: "must not be empty"},
+			internal.Problem{Path: "servers[1].credentials.password", Message: "must not be empty"},
+			internal.Problem{Path: "servers[1].control_panel_base_url", Message: "must be set, either for the server or as control_panel_base_url for all servers"},
+		))
+		Expect(err.Error()).To(HavePrefix("the config has 7 problem(s):\n  discord.channel_id: must not be empty\n"))
+	})
+
+	It("requires the bot or a webhook", func() {
+		c := validConfig()
+		c.Discord = nil
+
+		Expect(problems(c.Validate())).To(ConsistOf(internal.Problem{
+			Path:    "discord",
+			Message: "either the discord bot or at least one webhook needs to be configured",
+		}))
+
+		c.Webhooks = []internal.Webhook{{Url: "https://discord.com/api/webhooks/1/token"}}
+		Expect(c.Validate()).To(Succeed())
+	})
+
+	It("requires the servers of a webhook to be configured", func() {
+		c := validConfig()
+		c.Webhooks = []internal.Webhook{{Url: "https://discord.com/api/webhooks/1/token", Servers: []string{c.Servers[0].Name, "unknown"}}}
+
+		Expect(problems(c.Validate())).To(ConsistOf(internal.Problem{
+			Path:    "webhooks[0].servers[1]",
+			Message: `"unknown" is not the name of a configured server`,
+		}))
+	})
+
+	It("rejects a control panel base url with a scheme", func() {
+		c := validConfig()
+		c.ControlPanelBaseUrl = "https://qp.qonzer.com"
+
+		Expect(problems(c.Validate())).To(HaveLen(1))
+		Expect(problems(c.Validate())[0].Path).To(Equal("control_panel_base_url"))
+	})
+})
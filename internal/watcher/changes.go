@@ -0,0 +1,69 @@
+package watcher
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+)
+
+// Change is the difference between two successful polls of the same server.
+type Change struct {
+	Previous ServerInfo
+	Current  ServerInfo
+	// Role is the ID of the discord role which should be notified about the change
+	Role *string
+}
+
+func (c Change) NameChanged() bool {
+	return c.Previous.ServerName != c.Current.ServerName
+}
+
+func (c Change) PasswordChanged() bool {
+	return c.Previous.ServerPassword != c.Current.ServerPassword
+}
+
+// diff returns the change between the previous and current info of a server, or false if neither the server name
+// nor the password changed.
+func diff(previous, current ServerInfo, role *string) (Change, bool) {
+	c := Change{Previous: previous, Current: current, Role: role}
+	return c, c.NameChanged() || c.PasswordChanged()
+}
+
+func changeNotification(c Change) *discordgo.MessageSend {
+	color := internal.ColorDarkGrey
+	if c.Current.Color != nil {
+		color = *c.Current.Color
+	}
+	var fields []*discordgo.MessageEmbedField
+	if c.NameChanged() {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Server Name",
+			Value: "Old: " + valueOrNone(c.Previous.ServerName) + "\nNew: " + valueOrNone(c.Current.ServerName),
+		})
+	}
+	if c.PasswordChanged() {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Password",
+			Value: "Old: " + valueOrNone(c.Previous.ServerPassword) + "\nNew: " + valueOrNone(c.Current.ServerPassword),
+		})
+	}
+	m := &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{{
+			Title:  c.Current.Name + " changed",
+			Color:  color,
+			Fields: fields,
+		}},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+	if c.Role != nil {
+		m.Content = "<@&" + *c.Role + ">"
+		m.AllowedMentions.Roles = []string{*c.Role}
+	}
+	return m
+}
+
+func valueOrNone(v string) string {
+	if v == "" {
+		return "_none_"
+	}
+	return "`" + v + "`"
+}
@@ -0,0 +1,43 @@
+package watcher
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Changes", func() {
+	previous := ServerInfo{Name: "Event", ServerName: "Event Server", ServerPassword: "secret"}
+
+	It("does not report unchanged servers", func() {
+		_, changed := diff(previous, previous, nil)
+		Expect(changed).To(BeFalse())
+	})
+
+	It("reports a changed password", func() {
+		current := previous
+		current.ServerPassword = "new-secret"
+
+		c, changed := diff(previous, current, nil)
+
+		Expect(changed).To(BeTrue())
+		Expect(c.NameChanged()).To(BeFalse())
+		Expect(c.PasswordChanged()).To(BeTrue())
+		m := changeNotification(c)
+		Expect(m.Content).To(BeEmpty())
+		Expect(m.Embeds[0].Fields).To(HaveLen(1))
+		Expect(m.Embeds[0].Fields[0].Value).To(Equal("Old: `secret`\nNew: `new-secret`"))
+	})
+
+	It("mentions the configured role", func() {
+		current := previous
+		current.ServerName = "Event Server #2"
+		role := "1234"
+
+		c, changed := diff(previous, current, &role)
+
+		Expect(changed).To(BeTrue())
+		m := changeNotification(c)
+		Expect(m.Content).To(Equal("<@&1234>"))
+		Expect(m.AllowedMentions.Roles).To(ConsistOf("1234"))
+	})
+})
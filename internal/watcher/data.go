@@ -1,15 +1,63 @@
 package watcher
 
 import (
+	"context"
+	"time"
+
 	"github.com/floriansw/go-tcadmin"
 	"github.com/floriansw/hll-discord-server-watcher/internal"
 )
 
 type ServerQuery interface {
-	ServerInfo(serviceId string, opts tcadmin.ServerInfoOptions) (*tcadmin.ServerInfo, error)
+	ServerInfo(ctx context.Context, serviceId string, opts tcadmin.ServerInfoOptions) (*tcadmin.ServerInfo, error)
+}
+
+// ServerInfoSetter is implemented by ServerQuery implementations which support writing the server info back to the
+// control panel.
+type ServerInfoSetter interface {
+	SetServerInfo(ctx context.Context, serviceId string, name, pw string) error
+}
+
+// ServerRestarter is implemented by ServerQuery implementations which support restarting the server through the
+// control panel.
+type ServerRestarter interface {
+	Restart(ctx context.Context, serviceId string) (string, error)
 }
 
 type Server struct {
 	Query  ServerQuery
 	Config internal.Server
 }
+
+// Publisher publishes the state of the servers after each poll. Requests of the publisher are cancelled once ctx is
+// done.
+type Publisher interface {
+	Publish(ctx context.Context, s State)
+}
+
+// State is the result of a poll of all servers.
+type State struct {
+	// Servers are the infos of all servers in the order of the config
+	Servers []ServerInfo
+	// Changes are the changed server names and passwords since the previous poll
+	Changes []Change
+	// Alerts are messages for the admins about problems which need their attention
+	Alerts []string
+}
+
+type ServerInfo struct {
+	Name           string
+	Color          *int
+	ServerName     string
+	ServerPassword string
+	// Failure categorizes why the last poll of the server failed. ServerName and ServerPassword are the last known
+	// values of the server in this case. Empty if the last poll succeeded.
+	Failure FailureKind
+	// LastSuccess is the time of the last successful poll of the server, zero if there was none yet
+	LastSuccess time.Time
+}
+
+// Stale returns true if the info of the server could not be updated with the last poll.
+func (s ServerInfo) Stale() bool {
+	return s.Failure != ""
+}
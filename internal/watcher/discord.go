@@ -0,0 +1,292 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+)
+
+// discordSession is the part of the discord API used by the discordPublisher, it is implemented by *discordgo.Session.
+type discordSession interface {
+	User(userID string, options ...discordgo.RequestOption) (*discordgo.User, error)
+	ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string, options ...discordgo.RequestOption) ([]*discordgo.Message, error)
+	ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageEditComplex(m *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageDelete(channelID, messageID string, options ...discordgo.RequestOption) error
+}
+
+// requestOptions binds a request of the bot to ctx. Rate limited requests are not retried by the session, which would
+// sleep regardless of ctx, but returned as *discordgo.RateLimitError to be retried with retry instead.
+func requestOptions(ctx context.Context) []discordgo.RequestOption {
+	return []discordgo.RequestOption{discordgo.WithContext(ctx), discordgo.WithRetryOnRatelimit(false)}
+}
+
+// discordPublisher publishes the state of the servers as embeds in discord messages, which are edited with each poll.
+type discordPublisher struct {
+	logger *slog.Logger
+	s      discordSession
+	c      *atomic.Pointer[internal.Config]
+	state  *internal.State
+
+	// config is the config loaded at the start of the currently running Publish, so that a reload of the config does
+	// not change it in the middle of publishing. Publish is never called concurrently.
+	config *internal.Config
+}
+
+// NewDiscordPublisher creates a Publisher posting to the channels of the current config c. The IDs of the posted
+// messages are stored in state.
+func NewDiscordPublisher(l *slog.Logger, s discordSession, c *atomic.Pointer[internal.Config], state *internal.State) *discordPublisher {
+	return &discordPublisher{
+		logger: l,
+		s:      s,
+		c:      c,
+		state:  state,
+	}
+}
+
+func (p *discordPublisher) Publish(ctx context.Context, s State) {
+	p.config = p.c.Load()
+	if p.config.Discord.MessageMode == internal.MessageModePerServer {
+		p.publishPerServer(ctx, s.Servers)
+	} else {
+		p.publishCombined(ctx, s.Servers)
+	}
+	for _, c := range s.Changes {
+		p.notify(ctx, c)
+	}
+	for _, msg := range s.Alerts {
+		p.alert(ctx, msg)
+	}
+}
+
+// publishCombined publishes the status of all servers in as few messages as possible per channel. Messages of
+// servers left over from the per-server mode, as well as messages in channels no server is published to anymore,
+// are deleted.
+func (p *discordPublisher) publishCombined(ctx context.Context, s []ServerInfo) {
+	for name, m := range p.state.ServerMessages() {
+		p.deleteMessages(ctx, p.messageChannel(m), []internal.Message{m})
+		p.setServerMessage(name, nil)
+	}
+
+	var channels []string
+	infos := map[string][]ServerInfo{}
+	for _, info := range s {
+		channel := p.channel(info.Name)
+		if _, ok := infos[channel]; !ok {
+			channels = append(channels, channel)
+		}
+		infos[channel] = append(infos[channel], info)
+	}
+	existing := map[string][]internal.Message{}
+	for _, m := range p.state.Messages() {
+		channel := p.messageChannel(m)
+		existing[channel] = append(existing[channel], m)
+	}
+
+	var messages []internal.Message
+	for _, channel := range channels {
+		current := existing[channel]
+		if len(current) == 0 {
+			current = p.adoptMessages(ctx, channel)
+		}
+		messages = append(messages, p.syncMessages(ctx, channel, paginate(serverStatus(infos[channel])), current)...)
+		delete(existing, channel)
+	}
+	for channel, m := range existing {
+		p.deleteMessages(ctx, channel, m)
+	}
+	if err := p.state.SetMessages(messages); err != nil {
+		p.logger.Error("save-state", "error", err)
+	}
+}
+
+// publishPerServer publishes the status of each server in its own message. Messages left over from the combined mode
+// are deleted, as well as messages of servers which are published to a different channel now or which are not
+// configured anymore.
+func (p *discordPublisher) publishPerServer(ctx context.Context, s []ServerInfo) {
+	if messages := p.state.Messages(); len(messages) != 0 {
+		for _, m := range messages {
+			p.deleteMessages(ctx, p.messageChannel(m), []internal.Message{m})
+		}
+		if err := p.state.SetMessages(nil); err != nil {
+			p.logger.Error("save-state", "error", err)
+		}
+	}
+
+	existing := p.state.ServerMessages()
+	adopted := map[string]map[string]internal.Message{}
+	published := map[string]bool{}
+	embeds := serverStatus(s)
+	for idx, info := range s {
+		server := p.configServer(info.Name)
+		if server == nil {
+			continue
+		}
+		published[info.Name] = true
+		channel := p.config.Channel(*server)
+		var messages []internal.Message
+		if m, ok := existing[info.Name]; ok && p.messageChannel(m) == channel {
+			messages = []internal.Message{m}
+		} else {
+			if ok {
+				p.deleteMessages(ctx, p.messageChannel(m), []internal.Message{m})
+			}
+			if _, ok := adopted[channel]; !ok {
+				adopted[channel] = p.adoptServerMessages(ctx, channel)
+			}
+			if m, ok := adopted[channel][info.Name]; ok {
+				messages = []internal.Message{m}
+			}
+		}
+		messages = p.syncMessages(ctx, channel, [][]*discordgo.MessageEmbed{{embeds[idx]}}, messages)
+		if len(messages) != 0 {
+			p.setServerMessage(info.Name, &messages[0])
+		} else {
+			p.setServerMessage(info.Name, nil)
+		}
+	}
+	for name, m := range existing {
+		if !published[name] {
+			p.deleteMessages(ctx, p.messageChannel(m), []internal.Message{m})
+			p.setServerMessage(name, nil)
+		}
+	}
+}
+
+func (p *discordPublisher) setServerMessage(name string, m *internal.Message) {
+	if err := p.state.SetServerMessage(name, m); err != nil {
+		p.logger.Error("save-state", "error", err)
+	}
+}
+
+// MessageDeleted forgets the status message with the given ID, after it was deleted in discord. The next Publish posts
+// it again, even if the status did not change.
+func (p *discordPublisher) MessageDeleted(id string) {
+	p.removeMessages(func(m internal.Message) bool { return m.Id == id })
+}
+
+// ChannelDeleted forgets the status messages in the channel, after it was deleted in discord.
+func (p *discordPublisher) ChannelDeleted(channel string) {
+	fallback := p.c.Load().Discord.ChannelId
+	p.removeMessages(func(m internal.Message) bool {
+		return m.ChannelId == channel || m.ChannelId == "" && fallback == channel
+	})
+}
+
+func (p *discordPublisher) removeMessages(fn func(m internal.Message) bool) {
+	if err := p.state.RemoveMessages(fn); err != nil {
+		p.logger.Error("save-state", "error", err)
+	}
+}
+
+// channel returns the ID of the channel the status of the server with the given name is published to.
+func (p *discordPublisher) channel(name string) string {
+	if server := p.configServer(name); server != nil {
+		return p.config.Channel(*server)
+	}
+	return p.config.Discord.ChannelId
+}
+
+// messageChannel returns the ID of the channel the message was posted in.
+func (p *discordPublisher) messageChannel(m internal.Message) string {
+	if m.ChannelId != "" {
+		return m.ChannelId
+	}
+	return p.config.Discord.ChannelId
+}
+
+// configServer returns the server with the given name in the config.
+func (p *discordPublisher) configServer(name string) *internal.Server {
+	for idx := range p.config.Servers {
+		if p.config.Servers[idx].Name == name {
+			return &p.config.Servers[idx]
+		}
+	}
+	return nil
+}
+
+// alert notifies the admins about a problem which needs their attention.
+func (p *discordPublisher) alert(ctx context.Context, msg string) {
+	p.logger.Warn("admin-alert", "message", msg)
+	if p.config.Discord.AdminChannelId == nil {
+		return
+	}
+	err := retry(ctx, p.logger, "admin-alert", func() error {
+		_, err := p.s.ChannelMessageSend(*p.config.Discord.AdminChannelId, "⚠️ "+msg, requestOptions(ctx)...)
+		return err
+	})
+	if err != nil {
+		p.logger.Error("admin-alert", "error", err)
+	}
+}
+
+func (p *discordPublisher) notify(ctx context.Context, c Change) {
+	err := retry(ctx, p.logger, "notify-change", func() error {
+		_, err := p.s.ChannelMessageSendComplex(p.channel(c.Current.Name), changeNotification(c), requestOptions(ctx)...)
+		return err
+	})
+	if err != nil {
+		p.logger.Error("notify-change", "server", c.Current.Name, "error", err)
+	}
+}
+
+func serverStatus(s []ServerInfo) (embeds []*discordgo.MessageEmbed) {
+	for _, info := range s {
+		color := internal.ColorDarkGrey
+		if info.Color != nil {
+			color = *info.Color
+		}
+		if info.Stale() {
+			embeds = append(embeds, staleStatus(info))
+			continue
+		}
+		embeds = append(embeds, &discordgo.MessageEmbed{
+			Title: info.Name,
+			Color: color,
+			Fields: []*discordgo.MessageEmbedField{{
+				Name:  "Server Name",
+				Value: fieldValue(info.ServerName),
+			}, {
+				Name:  "Password",
+				Value: fieldValue(info.ServerPassword),
+			}},
+		})
+	}
+	return
+}
+
+func staleStatus(info ServerInfo) *discordgo.MessageEmbed {
+	e := &discordgo.MessageEmbed{
+		Title: info.Name,
+		Color: info.Failure.Color(),
+	}
+	if info.LastSuccess.IsZero() {
+		e.Description = "⚠️ " + info.Failure.Description() + ". The server could not be polled yet."
+		return e
+	}
+	e.Description = "⚠️ " + info.Failure.Description() + ". Showing the last known values, which might be outdated."
+	e.Fields = []*discordgo.MessageEmbedField{{
+		Name:  "Server Name (stale)",
+		Value: fieldValue(info.ServerName),
+	}, {
+		Name:  "Password (stale)",
+		Value: fieldValue(info.ServerPassword),
+	}, {
+		Name:  "Last successful poll",
+		Value: fmt.Sprintf("<t:%d:R>", info.LastSuccess.Unix()),
+	}}
+	return e
+}
+
+// fieldValue returns v as the value of an embed field, discord rejects embeds with empty field values.
+func fieldValue(v string) string {
+	if v == "" {
+		return "_none_"
+	}
+	return v
+}
@@ -0,0 +1,286 @@
+package watcher
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const botId = "bot"
+
+// fakeSession stands in for the discord API and keeps the messages posted into each channel, oldest first.
+type fakeSession struct {
+	channels map[string][]*discordgo.Message
+	nextId   int
+	// requests records the message requests in the form "<method> <channel>"
+	requests []string
+	// retryOnRateLimit records for each request, if the session would retry it itself when it is rate limited
+	retryOnRateLimit []bool
+}
+
+// record applies the options of a request to the defaults of the session and records the resulting configuration.
+func (f *fakeSession) record(options []discordgo.RequestOption) {
+	cfg := &discordgo.RequestConfig{Request: &http.Request{}, ShouldRetryOnRateLimit: true}
+	for _, o := range options {
+		o(cfg)
+	}
+	f.retryOnRateLimit = append(f.retryOnRateLimit, cfg.ShouldRetryOnRateLimit)
+}
+
+func unknownMessage() error {
+	return &discordgo.RESTError{
+		Response: &http.Response{StatusCode: http.StatusNotFound},
+		Message:  &discordgo.APIErrorMessage{Code: discordgo.ErrCodeUnknownMessage, Message: "Unknown Message"},
+	}
+}
+
+func (f *fakeSession) User(_ string, options ...discordgo.RequestOption) (*discordgo.User, error) {
+	f.record(options)
+	return &discordgo.User{ID: botId}, nil
+}
+
+func (f *fakeSession) ChannelMessages(channel string, limit int, _, _, _ string, options ...discordgo.RequestOption) ([]*discordgo.Message, error) {
+	f.record(options)
+	messages := slices.Clone(f.channels[channel])
+	slices.Reverse(messages)
+	return messages[:min(limit, len(messages))], nil
+}
+
+func (f *fakeSession) ChannelMessageSend(channel string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return f.ChannelMessageSendComplex(channel, &discordgo.MessageSend{Content: content}, options...)
+}
+
+func (f *fakeSession) ChannelMessageSendComplex(channel string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.record(options)
+	f.requests = append(f.requests, "send "+channel)
+	f.nextId++
+	m := &discordgo.Message{
+		ID:        strconv.Itoa(f.nextId),
+		ChannelID: channel,
+		Author:    &discordgo.User{ID: botId},
+		Content:   data.Content,
+		Embeds:    data.Embeds,
+	}
+	f.channels[channel] = append(f.channels[channel], m)
+	return m, nil
+}
+
+func (f *fakeSession) ChannelMessageEditComplex(e *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.record(options)
+	f.requests = append(f.requests, "edit "+e.Channel)
+	idx := slices.IndexFunc(f.channels[e.Channel], func(m *discordgo.Message) bool { return m.ID == e.ID })
+	if idx == -1 {
+		return nil, unknownMessage()
+	}
+	m := f.channels[e.Channel][idx]
+	m.Embeds = *e.Embeds
+	return m, nil
+}
+
+func (f *fakeSession) ChannelMessageDelete(channel, id string, options ...discordgo.RequestOption) error {
+	f.record(options)
+	f.requests = append(f.requests, "delete "+channel)
+	idx := slices.IndexFunc(f.channels[channel], func(m *discordgo.Message) bool { return m.ID == id })
+	if idx == -1 {
+		return unknownMessage()
+	}
+	f.channels[channel] = slices.Delete(f.channels[channel], idx, idx+1)
+	return nil
+}
+
+func (f *fakeSession) received() []string {
+	defer func() { f.requests = nil }()
+	return f.requests
+}
+
+// titles returns the titles of the embeds of each message in the channel.
+func (f *fakeSession) titles(channel string) (titles [][]string) {
+	for _, m := range f.channels[channel] {
+		var t []string
+		for _, e := range m.Embeds {
+			t = append(t, e.Title)
+		}
+		titles = append(titles, t)
+	}
+	return
+}
+
+var _ = Describe("DiscordPublisher", func() {
+	var fake *fakeSession
+	var config *atomic.Pointer[internal.Config]
+	var st *internal.State
+	var p *discordPublisher
+
+	newConfig := func(mode string, names ...string) *internal.Config {
+		c := &internal.Config{Discord: &internal.Discord{GuildId: "guild", ChannelId: "public", MessageMode: mode}}
+		for _, name := range names {
+			s := internal.Server{Name: name}
+			if name == "training" {
+				s.Discord = &internal.ServerDiscord{ChannelId: "members"}
+			}
+			c.Servers = append(c.Servers, s)
+		}
+		return c
+	}
+	state := func(names ...string) State {
+		var s State
+		for _, name := range names {
+			s.Servers = append(s.Servers, ServerInfo{Name: name, ServerName: name + " server", ServerPassword: "pw"})
+		}
+		return s
+	}
+
+	BeforeEach(func() {
+		fake = &fakeSession{channels: map[string][]*discordgo.Message{}}
+		config = &atomic.Pointer[internal.Config]{}
+		config.Store(newConfig(internal.MessageModeCombined, "A", "B", "training"))
+		st = newState()
+		p = NewDiscordPublisher(slog.New(slog.NewTextHandler(os.Stdout, nil)), fake, config, st)
+	})
+
+	Describe("combined", func() {
+		It("publishes the servers together, grouped by their channel", func() {
+			p.Publish(context.Background(), state("A", "B", "training"))
+
+			Expect(fake.titles("public")).To(Equal([][]string{{"A", "B"}}))
+			Expect(fake.titles("members")).To(Equal([][]string{{"training"}}))
+			Expect(st.Messages()).To(HaveLen(2))
+			Expect(st.Messages()[0].ChannelId).To(Equal("public"))
+			Expect(st.Messages()[1].ChannelId).To(Equal("members"))
+		})
+
+		It("edits the messages afterward", func() {
+			p.Publish(context.Background(), state("A", "B", "training"))
+			fake.received()
+
+			s := state("A", "B", "training")
+			s.Servers[0].ServerPassword = "changed"
+			p.Publish(context.Background(), s)
+
+			Expect(fake.received()).To(Equal([]string{"edit public"}))
+			Expect(fake.titles("public")).To(HaveLen(1))
+		})
+
+		It("recreates a message deleted in discord, although the status is unchanged", func() {
+			p.Publish(context.Background(), state("A", "B", "training"))
+			id := st.Messages()[1].Id
+			Expect(fake.ChannelMessageDelete("members", id)).To(Succeed())
+			p.MessageDeleted(id)
+			fake.received()
+
+			p.Publish(context.Background(), state("A", "B", "training"))
+
+			Expect(fake.received()).To(Equal([]string{"send members"}))
+			Expect(fake.titles("members")).To(Equal([][]string{{"training"}}))
+		})
+
+		It("recreates the messages of a deleted channel", func() {
+			p.Publish(context.Background(), state("A", "B", "training"))
+			delete(fake.channels, "public")
+			p.ChannelDeleted("public")
+			fake.received()
+
+			p.Publish(context.Background(), state("A", "B", "training"))
+
+			Expect(fake.received()).To(Equal([]string{"send public"}))
+			Expect(st.Messages()).To(HaveLen(2))
+		})
+
+		It("adopts the status messages of the bot, if their IDs got lost", func() {
+			_, _ = fake.ChannelMessageSendComplex("public", &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{{Title: "A"}}})
+			fake.received()
+
+			p.Publish(context.Background(), state("A", "B"))
+
+			Expect(fake.received()).To(Equal([]string{"edit public"}))
+			Expect(fake.titles("public")).To(Equal([][]string{{"A", "B"}}))
+		})
+
+		It("deletes the messages in channels no server is published to anymore", func() {
+			p.Publish(context.Background(), state("A", "B", "training"))
+			config.Store(newConfig(internal.MessageModeCombined, "A", "B"))
+
+			p.Publish(context.Background(), state("A", "B"))
+
+			Expect(fake.titles("members")).To(BeEmpty())
+			Expect(st.Messages()).To(HaveLen(1))
+		})
+	})
+
+	It("leaves retrying rate limited requests to retry", func() {
+		_, _ = fake.ChannelMessageSendComplex("public", &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{{Title: "B"}}})
+		fake.retryOnRateLimit = nil
+		adminChannel := "admin"
+		c := newConfig(internal.MessageModeCombined, "A", "B", "training")
+		c.Discord.AdminChannelId = &adminChannel
+		config.Store(c)
+
+		p.Publish(context.Background(), State{
+			Servers: state("A", "training").Servers,
+			Changes: []Change{{Previous: ServerInfo{Name: "A"}, Current: ServerInfo{Name: "A", ServerPassword: "pw"}}},
+			Alerts:  []string{"alert"},
+		})
+
+		Expect(fake.retryOnRateLimit).ToNot(BeEmpty())
+		Expect(fake.retryOnRateLimit).To(HaveEach(BeFalse()))
+	})
+
+	Describe("per server", func() {
+		BeforeEach(func() {
+			config.Store(newConfig(internal.MessageModePerServer, "A", "B", "training"))
+		})
+
+		It("publishes each server in its own message in its channel", func() {
+			p.Publish(context.Background(), state("A", "B", "training"))
+
+			Expect(fake.titles("public")).To(Equal([][]string{{"A"}, {"B"}}))
+			Expect(fake.titles("members")).To(Equal([][]string{{"training"}}))
+			Expect(st.ServerMessages()).To(HaveKey("A"))
+			Expect(st.ServerMessages()).To(HaveKey("B"))
+			Expect(st.ServerMessages()["training"].ChannelId).To(Equal("members"))
+		})
+
+		It("edits only the message of the changed server", func() {
+			p.Publish(context.Background(), state("A", "B", "training"))
+			fake.received()
+
+			s := state("A", "B", "training")
+			s.Servers[1].ServerPassword = "changed"
+			p.Publish(context.Background(), s)
+
+			Expect(fake.received()).To(Equal([]string{"edit public"}))
+			Expect(fake.channels["public"][1].Embeds[0].Fields[1].Value).To(Equal("changed"))
+		})
+
+		It("deletes the messages of servers which are not configured anymore", func() {
+			p.Publish(context.Background(), state("A", "B", "training"))
+			config.Store(newConfig(internal.MessageModePerServer, "A", "training"))
+
+			p.Publish(context.Background(), state("A", "training"))
+
+			Expect(fake.titles("public")).To(Equal([][]string{{"A"}}))
+			Expect(st.ServerMessages()).ToNot(HaveKey("B"))
+		})
+
+		It("deletes the messages of the combined mode", func() {
+			config.Store(newConfig(internal.MessageModeCombined, "A", "B", "training"))
+			p.Publish(context.Background(), state("A", "B", "training"))
+			config.Store(newConfig(internal.MessageModePerServer, "A", "B", "training"))
+
+			p.Publish(context.Background(), state("A", "B", "training"))
+
+			Expect(fake.titles("public")).To(Equal([][]string{{"A"}, {"B"}}))
+			Expect(fake.titles("members")).To(Equal([][]string{{"training"}}))
+			Expect(st.Messages()).To(BeEmpty())
+		})
+	})
+})
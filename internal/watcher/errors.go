@@ -0,0 +1,129 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+)
+
+// FailureKind categorizes why a server could not be queried.
+type FailureKind string
+
+const (
+	// FailureAuthentication means the control panel rejected the credentials of the server.
+	FailureAuthentication = FailureKind("authentication")
+	// FailureUnreachable means no connection to the control panel could be established.
+	FailureUnreachable = FailureKind("unreachable")
+	// FailureUnexpectedStatus means the control panel responded with an unexpected HTTP status code.
+	FailureUnexpectedStatus = FailureKind("unexpected-status")
+	// FailureUnparseable means the pages of the control panel did not have the expected layout.
+	FailureUnparseable = FailureKind("unparseable")
+	// FailureTimeout means the control panel did not respond in time.
+	FailureTimeout = FailureKind("timeout")
+	// FailureUnknown is used for all errors which do not fit in any other category.
+	FailureUnknown = FailureKind("unknown")
+)
+
+// Description returns a human-readable description of the failure kind, telling admins what to do about it.
+func (k FailureKind) Description() string {
+	switch k {
+	case FailureAuthentication:
+		return "Authentication failed, please check the credentials of the control panel user"
+	case FailureUnreachable:
+		return "Control panel unreachable, the hoster might have an outage"
+	case FailureUnexpectedStatus:
+		return "Control panel responded unexpectedly, the user might lack permissions for the server"
+	case FailureUnparseable:
+		return "Control panel page could not be read, its layout might have changed"
+	case FailureTimeout:
+		return "Control panel timed out, the hoster might have an outage"
+	default:
+		return "Query failed"
+	}
+}
+
+// Color returns the discord color in which servers with this failure are shown.
+func (k FailureKind) Color() int {
+	switch k {
+	case FailureAuthentication:
+		return internal.ColorRed
+	case FailureUnreachable:
+		return internal.ColorNavy
+	case FailureUnexpectedStatus:
+		return internal.ColorOrange
+	case FailureUnparseable:
+		return internal.ColorPurple
+	case FailureTimeout:
+		return internal.ColorGold
+	default:
+		return internal.ColorDarkRed
+	}
+}
+
+// QueryError is returned when a server could not be queried.
+type QueryError struct {
+	Kind FailureKind
+	Err  error
+}
+
+func (e *QueryError) Error() string {
+	return string(e.Kind) + ": " + e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// classify wraps err in a QueryError with the FailureKind matching err. The tcadmin client returns plain errors,
+// hence some kinds can only be identified by the error message.
+func classify(err error) *QueryError {
+	var qe *QueryError
+	if errors.As(err, &qe) {
+		return qe
+	}
+	return &QueryError{Kind: failureKind(err), Err: err}
+}
+
+func failureKind(err error) FailureKind {
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case os.IsTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		return FailureTimeout
+	case errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE),
+		errors.As(err, &netErr):
+		return FailureUnreachable
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return FailureUnparseable
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "invalid username or password"):
+		return FailureAuthentication
+	case strings.Contains(msg, "invalid response code"):
+		return FailureUnexpectedStatus
+	case strings.Contains(msg, "encountered invalid state"):
+		return FailureUnparseable
+	}
+	return FailureUnknown
+}
+
+// isDiscordError returns true if err is an error returned by the discord API with one of the given codes.
+func isDiscordError(err error, codes ...int) bool {
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) || restErr.Message == nil {
+		return false
+	}
+	return slices.Contains(codes, restErr.Message.Code)
+}
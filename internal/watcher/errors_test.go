@@ -0,0 +1,46 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/bwmarrin/discordgo"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("classify", func() {
+	cases := []struct {
+		name string
+		err  error
+		kind FailureKind
+	}{
+		{"wrong credentials", errors.New("invalid username or password"), FailureAuthentication},
+		{"unexpected status", fmt.Errorf("invalid response code, expected 200, got %d with Location %s", 302, "/login"), FailureUnexpectedStatus},
+		{"timeout", fmt.Errorf("get: %w", context.DeadlineExceeded), FailureTimeout},
+		{"refused connection", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, FailureUnreachable},
+		{"unknown host", &net.DNSError{Err: "no such host", Name: "panel.example.com"}, FailureUnreachable},
+		{"invalid page", errors.New("encountered invalid state"), FailureUnparseable},
+		{"anything else", errors.New("boom"), FailureUnknown},
+	}
+	for _, c := range cases {
+		It("categorizes "+c.name, func() {
+			Expect(classify(c.err).Kind).To(Equal(c.kind))
+			Expect(classify(c.err)).To(MatchError(c.err))
+		})
+	}
+})
+
+var _ = Describe("isDiscordError", func() {
+	It("matches the code of discord API errors", func() {
+		err := fmt.Errorf("edit: %w", &discordgo.RESTError{Message: &discordgo.APIErrorMessage{Code: discordgo.ErrCodeUnknownMessage}})
+
+		Expect(isDiscordError(err, discordgo.ErrCodeUnknownMessage, discordgo.ErrCodeUnknownChannel)).To(BeTrue())
+		Expect(isDiscordError(err, discordgo.ErrCodeUnknownChannel)).To(BeFalse())
+		Expect(isDiscordError(errors.New("boom"), discordgo.ErrCodeUnknownMessage)).To(BeFalse())
+	})
+})
@@ -0,0 +1,218 @@
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+)
+
+const (
+	// maxEmbedsPerMessage is the maximum number of embeds discord accepts in a single message
+	maxEmbedsPerMessage = 10
+	// adoptMessageLimit is the number of recent messages searched for existing status messages
+	adoptMessageLimit = 50
+)
+
+// paginate splits the embeds into pages, which fit into a single discord message each.
+func paginate(embeds []*discordgo.MessageEmbed) [][]*discordgo.MessageEmbed {
+	return slices.Collect(slices.Chunk(embeds, maxEmbedsPerMessage))
+}
+
+// messageTarget is a destination status messages are published to, e.g. a discord channel or a webhook.
+type messageTarget interface {
+	createMessage(ctx context.Context, embeds []*discordgo.MessageEmbed) (string, error)
+	// updateMessage replaces the embeds of the message. The returned error wraps errMessageGone, if the message does
+	// not exist anymore.
+	updateMessage(ctx context.Context, id string, embeds []*discordgo.MessageEmbed) error
+	deleteMessages(ctx context.Context, messages []internal.Message)
+}
+
+// errMessageGone indicates that a managed message was deleted outside the watcher.
+var errMessageGone = errors.New("message does not exist anymore")
+
+// syncMessages publishes one message per page to the target and returns the messages which are managed afterward, in
+// the order of the pages. Existing messages are edited if their content changed, missing messages are created and
+// surplus messages are deleted. If an existing message was deleted, it is recreated together with all following
+// messages to keep the order of the pages stable.
+func syncMessages(ctx context.Context, l *slog.Logger, t messageTarget, pages [][]*discordgo.MessageEmbed, messages []internal.Message) (result []internal.Message) {
+	for idx, page := range pages {
+		fp, err := fingerprint(page)
+		if err != nil {
+			l.Error("fingerprint", "error", err)
+		}
+		if idx < len(messages) {
+			m := messages[idx]
+			if fp != "" && m.Fingerprint == fp {
+				l.Info("publish-skipped", "reason", "status unchanged", "message", m.Id)
+				result = append(result, m)
+				continue
+			}
+			err := t.updateMessage(ctx, m.Id, page)
+			if err == nil {
+				result = append(result, internal.Message{Id: m.Id, ChannelId: m.ChannelId, Fingerprint: fp})
+				continue
+			}
+			if !errors.Is(err, errMessageGone) {
+				l.Error("update-message", "message", m.Id, "error", err)
+				result = append(result, m)
+				continue
+			}
+			l.Warn("update-message", "message", m.Id, "error", err)
+			t.deleteMessages(ctx, messages[idx+1:])
+			messages = messages[:idx]
+		}
+		id, err := t.createMessage(ctx, page)
+		if err != nil {
+			l.Error("create-message", "error", err)
+			break
+		}
+		result = append(result, internal.Message{Id: id, Fingerprint: fp})
+	}
+	if len(messages) > len(pages) {
+		t.deleteMessages(ctx, messages[len(pages):])
+	}
+	return
+}
+
+// syncMessages publishes the pages into the channel, see syncMessages.
+func (p *discordPublisher) syncMessages(ctx context.Context, channel string, pages [][]*discordgo.MessageEmbed, messages []internal.Message) []internal.Message {
+	result := syncMessages(ctx, p.logger, &channelTarget{p: p, channel: channel}, pages, messages)
+	for idx := range result {
+		result[idx].ChannelId = channel
+	}
+	return result
+}
+
+// channelTarget publishes status messages into a discord channel through the bot.
+type channelTarget struct {
+	p       *discordPublisher
+	channel string
+}
+
+func (t *channelTarget) createMessage(ctx context.Context, embeds []*discordgo.MessageEmbed) (string, error) {
+	var message *discordgo.Message
+	err := retry(ctx, t.p.logger, "create-message", func() (err error) {
+		message, err = t.p.s.ChannelMessageSendComplex(t.channel, &discordgo.MessageSend{
+			Embeds: embeds,
+		}, requestOptions(ctx)...)
+		return
+	})
+	if err != nil {
+		return "", err
+	}
+	return message.ID, nil
+}
+
+func (t *channelTarget) updateMessage(ctx context.Context, id string, embeds []*discordgo.MessageEmbed) error {
+	err := retry(ctx, t.p.logger, "update-message", func() error {
+		_, err := t.p.s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			Embeds:  &embeds,
+			ID:      id,
+			Channel: t.channel,
+		}, requestOptions(ctx)...)
+		return err
+	})
+	return t.gone(ctx, err)
+}
+
+// gone wraps err with errMessageGone, if the message or the whole channel does not exist anymore. The admins are
+// alerted about a missing channel, as it needs to be fixed in the config.
+func (t *channelTarget) gone(ctx context.Context, err error) error {
+	if isDiscordError(err, discordgo.ErrCodeUnknownChannel) {
+		t.p.alert(ctx, "The status channel "+t.channel+" does not exist anymore or the bot can not access it. "+
+			"Please check the channel_id in the config.")
+	}
+	if isDiscordError(err, discordgo.ErrCodeUnknownMessage, discordgo.ErrCodeUnknownChannel) {
+		return fmt.Errorf("%w: %w", errMessageGone, err)
+	}
+	return err
+}
+
+func (t *channelTarget) deleteMessages(ctx context.Context, messages []internal.Message) {
+	t.p.deleteMessages(ctx, t.channel, messages)
+}
+
+func (p *discordPublisher) deleteMessages(ctx context.Context, channel string, messages []internal.Message) {
+	for _, m := range messages {
+		err := retry(ctx, p.logger, "delete-message", func() error {
+			return p.s.ChannelMessageDelete(channel, m.Id, requestOptions(ctx)...)
+		})
+		if err != nil && !isDiscordError(err, discordgo.ErrCodeUnknownMessage, discordgo.ErrCodeUnknownChannel) {
+			p.logger.Error("delete-message", "message", m.Id, "error", err)
+		}
+	}
+}
+
+// adoptMessages searches the recent messages of the channel for status messages previously posted by the bot and
+// returns them in the order they were posted. This prevents duplicate status messages, if the message IDs got lost.
+func (p *discordPublisher) adoptMessages(ctx context.Context, channel string) []internal.Message {
+	var adopted []internal.Message
+	for _, m := range p.statusMessages(ctx, channel) {
+		p.logger.Info("adopt-message", "message", m.ID)
+		adopted = append(adopted, internal.Message{Id: m.ID, ChannelId: channel})
+	}
+	return adopted
+}
+
+// adoptServerMessages works like adoptMessages, but returns the most recent status message showing only a single
+// server, by the name of the server.
+func (p *discordPublisher) adoptServerMessages(ctx context.Context, channel string) map[string]internal.Message {
+	adopted := map[string]internal.Message{}
+	for _, m := range p.statusMessages(ctx, channel) {
+		if len(m.Embeds) == 1 {
+			adopted[m.Embeds[0].Title] = internal.Message{Id: m.ID, ChannelId: channel}
+		}
+	}
+	return adopted
+}
+
+// statusMessages returns the recent status messages posted by the bot into the channel, oldest first.
+func (p *discordPublisher) statusMessages(ctx context.Context, channel string) (result []*discordgo.Message) {
+	me, err := p.s.User("@me", requestOptions(ctx)...)
+	if err != nil {
+		p.logger.Error("adopt-message", "error", err)
+		return nil
+	}
+	messages, err := p.s.ChannelMessages(channel, adoptMessageLimit, "", "", "", requestOptions(ctx)...)
+	if err != nil {
+		p.logger.Error("adopt-message", "error", err)
+		return nil
+	}
+	for _, m := range slices.Backward(messages) {
+		if m.Author != nil && m.Author.ID == me.ID && p.isStatusMessage(m) {
+			result = append(result, m)
+		}
+	}
+	return
+}
+
+// isStatusMessage returns true if all embeds of the message are titled with the name of a configured server.
+func (p *discordPublisher) isStatusMessage(m *discordgo.Message) bool {
+	if m.Content != "" || len(m.Embeds) == 0 {
+		return false
+	}
+	for _, e := range m.Embeds {
+		if p.configServer(e.Title) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// fingerprint returns a hash of the given embeds, which changes whenever the rendered status changes.
+func fingerprint(embeds []*discordgo.MessageEmbed) (string, error) {
+	b, err := json.Marshal(embeds)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
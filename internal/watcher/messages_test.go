@@ -0,0 +1,26 @@
+package watcher
+
+import (
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("paginate", func() {
+	It("splits more than 10 embeds into multiple pages", func() {
+		var embeds []*discordgo.MessageEmbed
+		for range 11 {
+			embeds = append(embeds, &discordgo.MessageEmbed{})
+		}
+
+		pages := paginate(embeds)
+
+		Expect(pages).To(HaveLen(2))
+		Expect(pages[0]).To(HaveLen(10))
+		Expect(pages[1]).To(ConsistOf(embeds[10]))
+	})
+
+	It("returns no pages without embeds", func() {
+		Expect(paginate(nil)).To(BeEmpty())
+	})
+})
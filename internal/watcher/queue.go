@@ -0,0 +1,64 @@
+package watcher
+
+import "sync"
+
+// publishQueue hands the polled states over to a single goroutine, which publishes them one after another. Only the
+// latest state is kept while a publish is running. The changes and alerts of replaced states are carried over to the
+// latest state, so that no notification is lost.
+type publishQueue struct {
+	mu      sync.Mutex
+	pending *State
+	closed  bool
+	signal  chan struct{}
+}
+
+func newPublishQueue() *publishQueue {
+	return &publishQueue{signal: make(chan struct{}, 1)}
+}
+
+// push replaces the pending state with s.
+func (q *publishQueue) push(s State) {
+	q.mu.Lock()
+	if q.pending != nil {
+		s.Changes = append(q.pending.Changes, s.Changes...)
+		s.Alerts = append(q.pending.Alerts, s.Alerts...)
+	}
+	q.pending = &s
+	q.mu.Unlock()
+	q.notify()
+}
+
+// close stops the queue. States which are pending already are still returned by pop.
+func (q *publishQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.notify()
+}
+
+// pop waits for the next pending state and removes it from the queue. ok is false if the queue was closed and no
+// state is pending anymore.
+func (q *publishQueue) pop() (s State, ok bool) {
+	for {
+		q.mu.Lock()
+		if q.pending != nil {
+			s = *q.pending
+			q.pending = nil
+			q.mu.Unlock()
+			return s, true
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return State{}, false
+		}
+		q.mu.Unlock()
+		<-q.signal
+	}
+}
+
+func (q *publishQueue) notify() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
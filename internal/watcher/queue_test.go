@@ -0,0 +1,43 @@
+package watcher
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("publishQueue", func() {
+	It("keeps only the latest servers but all changes and alerts", func() {
+		q := newPublishQueue()
+		q.push(State{
+			Servers: []ServerInfo{{Name: "A", ServerPassword: "one"}},
+			Changes: []Change{{Current: ServerInfo{Name: "A", ServerPassword: "one"}}},
+			Alerts:  []string{"first"},
+		})
+		q.push(State{
+			Servers: []ServerInfo{{Name: "A", ServerPassword: "two"}},
+			Changes: []Change{{Current: ServerInfo{Name: "A", ServerPassword: "two"}}},
+			Alerts:  []string{"second"},
+		})
+
+		s, ok := q.pop()
+
+		Expect(ok).To(BeTrue())
+		Expect(s.Servers).To(HaveLen(1))
+		Expect(s.Servers[0].ServerPassword).To(Equal("two"))
+		Expect(s.Changes).To(HaveLen(2))
+		Expect(s.Alerts).To(Equal([]string{"first", "second"}))
+	})
+
+	It("returns pending states after it was closed", func() {
+		q := newPublishQueue()
+		q.push(State{Alerts: []string{"pending"}})
+		q.close()
+
+		s, ok := q.pop()
+		Expect(ok).To(BeTrue())
+		Expect(s.Alerts).To(Equal([]string{"pending"}))
+
+		_, ok = q.pop()
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,71 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maxAttempts is the number of times a request to discord is sent before giving up
+	maxAttempts = 4
+	// maxBackoff limits the time waited between two attempts
+	maxBackoff = 30 * time.Second
+)
+
+// initialBackoff is the time waited before the first retry, it is doubled for each following retry.
+var initialBackoff = time.Second
+
+// retry calls fn until it succeeds, it returns an error which is not temporary, maxAttempts are reached or ctx is done.
+// Discord errors are temporary, if discord is overloaded (5xx) or rate limits the requests (429). The error of the
+// last attempt is returned.
+func retry(ctx context.Context, l *slog.Logger, op string, fn func() error) error {
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		wait, temporary := retryAfter(err)
+		if err == nil || !temporary || attempt == maxAttempts {
+			return err
+		}
+		wait = min(max(wait, backoff), maxBackoff)
+		l.Warn(op, "attempt", attempt, "retry-in", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// retryAfter returns true if err is a temporary discord error, together with the time discord asked to wait before
+// retrying, if any. The discord session retries 502 responses itself and returns a *discordgo.RateLimitError for
+// rate limited requests, as requestOptions disables its own retries, while webhook requests return the 429 response
+// as *discordgo.RESTError.
+func retryAfter(err error) (time.Duration, bool) {
+	var rateLimitErr *discordgo.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		if rateLimitErr.RateLimit == nil || rateLimitErr.TooManyRequests == nil {
+			return 0, true
+		}
+		return rateLimitErr.RetryAfter, true
+	}
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) || restErr.Response == nil {
+		return 0, false
+	}
+	code := restErr.Response.StatusCode
+	if code != http.StatusTooManyRequests {
+		return 0, code >= 500
+	}
+	s, err := strconv.ParseFloat(restErr.Response.Header.Get("Retry-After"), 64)
+	if err != nil {
+		return 0, true
+	}
+	return time.Duration(s * float64(time.Second)), true
+}
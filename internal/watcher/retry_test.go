@@ -0,0 +1,104 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func restError(code int) error {
+	return &discordgo.RESTError{Response: &http.Response{StatusCode: code, Header: http.Header{}}}
+}
+
+var _ = Describe("retry", func() {
+	l := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	BeforeEach(func() {
+		initialBackoff = time.Millisecond
+	})
+	AfterEach(func() {
+		initialBackoff = time.Second
+	})
+
+	It("retries temporary discord errors", func() {
+		var attempts int
+		err := retry(context.Background(), l, "test", func() error {
+			attempts++
+			if attempts == 1 {
+				return restError(http.StatusServiceUnavailable)
+			}
+			if attempts == 2 {
+				return restError(http.StatusTooManyRequests)
+			}
+			return nil
+		})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(attempts).To(Equal(3))
+	})
+
+	It("retries requests rate limited by the discord session", func() {
+		var attempts int
+		err := retry(context.Background(), l, "test", func() error {
+			attempts++
+			if attempts == 1 {
+				return &discordgo.RateLimitError{RateLimit: &discordgo.RateLimit{
+					TooManyRequests: &discordgo.TooManyRequests{RetryAfter: time.Millisecond},
+				}}
+			}
+			return nil
+		})
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(attempts).To(Equal(2))
+	})
+
+	It("stops waiting for the next attempt when the context is done", func() {
+		initialBackoff = time.Hour
+		ctx, cancel := context.WithCancel(context.Background())
+		var attempts int
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+
+		err := retry(ctx, l, "test", func() error {
+			attempts++
+			return restError(http.StatusServiceUnavailable)
+		})
+
+		Expect(err).To(HaveOccurred())
+		Expect(attempts).To(Equal(1))
+	})
+
+	It("gives up after the maximum number of attempts", func() {
+		var attempts int
+		err := retry(context.Background(), l, "test", func() error {
+			attempts++
+			return restError(http.StatusBadGateway)
+		})
+
+		Expect(err).To(HaveOccurred())
+		Expect(attempts).To(Equal(maxAttempts))
+	})
+
+	It("does not retry other errors", func() {
+		for _, e := range []error{restError(http.StatusNotFound), errors.New("boom")} {
+			var attempts int
+			err := retry(context.Background(), l, "test", func() error {
+				attempts++
+				return e
+			})
+
+			Expect(err).To(Equal(e))
+			Expect(attempts).To(Equal(1))
+		}
+	})
+})
@@ -0,0 +1,116 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/floriansw/go-tcadmin"
+)
+
+type tcAdminClient interface {
+	ServerInfo(serviceId string, opts tcadmin.ServerInfoOptions) (*tcadmin.ServerInfo, error)
+	SetServerInfo(serviceId string, name, pw string) error
+	Restart(serviceId string) (string, error)
+}
+
+// tcAdminServer adapts the tcadmin client to the context aware interfaces of the watcher. The tcadmin client does not
+// accept a context, hence the context of the currently running call is attached to all requests the client sends
+// through its http.Client. Calls are serialized, as the client is not safe for concurrent use.
+type tcAdminServer struct {
+	client    tcAdminClient
+	transport *contextTransport
+	sem       chan struct{}
+}
+
+// NewTCAdminServer creates a ServerQuery, ServerInfoSetter and ServerRestarter for a TCAdmin control panel. The
+// transport of hc is wrapped to support cancelling requests through the context passed to the calls.
+func NewTCAdminServer(hc http.Client, baseUrl, gameId, modId, configFileId string, creds tcadmin.Credentials) *tcAdminServer {
+	t := &contextTransport{base: hc.Transport}
+	if t.base == nil {
+		t.base = http.DefaultTransport
+	}
+	hc.Transport = t
+	return &tcAdminServer{
+		client:    tcadmin.NewClient(hc, baseUrl, gameId, modId, configFileId, creds),
+		transport: t,
+		sem:       make(chan struct{}, 1),
+	}
+}
+
+func (s *tcAdminServer) ServerInfo(ctx context.Context, serviceId string, opts tcadmin.ServerInfoOptions) (*tcadmin.ServerInfo, error) {
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return s.client.ServerInfo(serviceId, opts)
+}
+
+// SetServerInfo writes the server name and password to the config page of the server. The tcadmin client parses the
+// config page without checking if it could be loaded and panics otherwise, e.g. when the session expired. Hence, the
+// page is loaded upfront to return its error, and a panic of the client is returned as an error as well.
+func (s *tcAdminServer) SetServerInfo(ctx context.Context, serviceId string, name, pw string) (err error) {
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("set server info: %v", r)
+		}
+	}()
+	if _, err := s.client.ServerInfo(serviceId, tcadmin.ServerInfoOptions{}); err != nil {
+		return err
+	}
+	return s.client.SetServerInfo(serviceId, name, pw)
+}
+
+func (s *tcAdminServer) Restart(ctx context.Context, serviceId string) (string, error) {
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return s.client.Restart(serviceId)
+}
+
+// acquire waits until no other call is running and binds ctx to the requests of the client until the returned
+// function is called.
+func (s *tcAdminServer) acquire(ctx context.Context) (func(), error) {
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	s.transport.bind(ctx)
+	return func() {
+		s.transport.bind(nil)
+		<-s.sem
+	}, nil
+}
+
+type contextTransport struct {
+	base http.RoundTripper
+
+	mu  sync.Mutex
+	ctx context.Context
+}
+
+func (t *contextTransport) bind(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ctx = ctx
+}
+
+func (t *contextTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	ctx := t.ctx
+	t.mu.Unlock()
+	if ctx != nil {
+		r = r.WithContext(ctx)
+	}
+	return t.base.RoundTrip(r)
+}
@@ -0,0 +1,75 @@
+package watcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/floriansw/go-tcadmin"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TCAdminServer", func() {
+	It("cancels requests to the control panel with the context", func() {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer srv.Close()
+		s := NewTCAdminServer(*srv.Client(), strings.TrimPrefix(srv.URL, "https://"), "", "", "", tcadmin.Credentials{})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := s.ServerInfo(ctx, "1", tcadmin.ServerInfoOptions{})
+
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+
+	Describe("SetServerInfo", func() {
+		var (
+			srv        *httptest.Server
+			configPage atomic.Int32
+			s          *tcAdminServer
+		)
+
+		BeforeEach(func() {
+			configPage.Store(0)
+			srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.Contains(r.URL.Path, "MvcConfigEditor") {
+					return
+				}
+				// the config page can be loaded once only, afterward the session expired
+				if configPage.Add(1) > 1 {
+					w.Header().Set("Location", "/Aspx/Interface/Base/Login.aspx")
+					w.WriteHeader(http.StatusFound)
+				}
+			}))
+			hc := *srv.Client()
+			hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			}
+			s = NewTCAdminServer(hc, strings.TrimPrefix(srv.URL, "https://"), "", "", "", tcadmin.Credentials{})
+		})
+
+		AfterEach(func() {
+			srv.Close()
+		})
+
+		It("returns an error if the config page can not be loaded", func() {
+			configPage.Store(1)
+
+			err := s.SetServerInfo(context.Background(), "1", "name", "password")
+
+			Expect(err).To(MatchError(ContainSubstring("got 302")))
+		})
+
+		It("returns an error instead of panicking if the client fails", func() {
+			err := s.SetServerInfo(context.Background(), "1", "name", "password")
+
+			Expect(err).To(MatchError(ContainSubstring("set server info")))
+		})
+	})
+})
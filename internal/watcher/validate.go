@@ -0,0 +1,20 @@
+package watcher
+
+import (
+	"errors"
+
+	"github.com/floriansw/go-tcadmin"
+)
+
+// validate checks the parsed info of a server for signs of a changed control panel layout. The tcadmin client
+// returns empty values instead of an error, if it can not find the server name or password on the page. A removed
+// password is only valid, if it is known to be removed, e.g. because it was removed through the watcher.
+func validate(si *tcadmin.ServerInfo, previous *ServerInfo, passwordRemoved bool) error {
+	if si.Name == "" {
+		return &QueryError{Kind: FailureUnparseable, Err: errors.New("server name is empty")}
+	}
+	if previous != nil && previous.ServerPassword != "" && si.Password == "" && !passwordRemoved {
+		return &QueryError{Kind: FailureUnparseable, Err: errors.New("password disappeared")}
+	}
+	return nil
+}
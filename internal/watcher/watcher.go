@@ -1,52 +1,241 @@
 package watcher
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"log/slog"
-	"os"
-	"syscall"
+	"maps"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/bwmarrin/discordgo"
 	"github.com/floriansw/go-tcadmin"
 	"github.com/floriansw/hll-discord-server-watcher/internal"
 )
 
+// shutdownTimeout is the time Shutdown waits for the pending state to be published, before the requests of the
+// publishers, including their retries, are cancelled.
+var shutdownTimeout = 10 * time.Second
+
+const (
+	defaultTimeout = 30 * time.Second
+	// passwordRemovedPolls is the number of consecutive polls without a password, after which a disappeared password
+	// is accepted as removed, although it was not removed through the watcher, e.g. directly in the control panel
+	passwordRemovedPolls = 3
+)
+
 type watcher struct {
-	logger  *slog.Logger
-	servers []Server
-	s       *discordgo.Session
-	c       *internal.Config
+	logger     *slog.Logger
+	servers    []Server
+	publishers []Publisher
+	state      *internal.State
+
+	ticker      *time.Ticker
+	refresh     chan struct{}
+	concurrency int
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	loop       sync.WaitGroup
+	queue      *publishQueue
+	publishing sync.WaitGroup
+	// publishCtx is passed to the publishers, it is cancelled separately from ctx to publish the pending state on
+	// Shutdown
+	publishCtx    context.Context
+	cancelPublish context.CancelFunc
 
-	ticker *time.Ticker
+	// mu guards the servers, publishers and concurrency, which can be replaced with Reload, as well as the following
+	// fields
+	mu   sync.RWMutex
+	last map[string]ServerInfo
+	// removed contains the servers of which the password was removed through the watcher
+	removed map[string]bool
+	// unparseable contains the servers for which the admins were alerted about an unparseable control panel
+	unparseable map[string]bool
+	// missingPassword counts the consecutive polls of each server with a server name, but without a password
+	missingPassword map[string]int
 }
 
-func NewWatcher(l *slog.Logger, s *discordgo.Session, c *internal.Config, servers []Server, d time.Duration) *watcher {
+// NewWatcher creates a watcher polling all servers every d, with at most concurrency servers being queried at the same
+// time. The state of the servers is published to all publishers after each poll. The last known values of the servers
+// are restored from, and persisted in, state.
+func NewWatcher(l *slog.Logger, servers []Server, publishers []Publisher, state *internal.State, d time.Duration, concurrency int) *watcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	publishCtx, cancelPublish := context.WithCancel(context.Background())
+	last := map[string]ServerInfo{}
+	for name, v := range state.LastKnown() {
+		last[name] = ServerInfo{
+			Name:           name,
+			ServerName:     v.ServerName,
+			ServerPassword: v.ServerPassword,
+			LastSuccess:    v.LastSuccess,
+		}
+	}
 	return &watcher{
-		logger:  l,
-		servers: servers,
-		ticker:  time.NewTicker(d),
-		s:       s,
-		c:       c,
+		logger:          l,
+		servers:         servers,
+		publishers:      publishers,
+		state:           state,
+		ticker:          time.NewTicker(d),
+		refresh:         make(chan struct{}, 1),
+		concurrency:     max(concurrency, 1),
+		ctx:             ctx,
+		cancel:          cancel,
+		queue:           newPublishQueue(),
+		publishCtx:      publishCtx,
+		cancelPublish:   cancelPublish,
+		last:            last,
+		removed:         map[string]bool{},
+		unparseable:     map[string]bool{},
+		missingPassword: map[string]int{},
 	}
 }
 
 func (w *watcher) Run() {
-	go w.watchServers()
+	w.loop.Go(w.watchServers)
+	w.publishing.Go(w.publishStates)
 }
 
-type serverInfo struct {
-	Name           string
-	Color          *int
-	ServerName     string
-	ServerPassword string
+// Once polls all servers a single time and publishes the result, instead of polling them regularly with Run. It
+// returns an error naming the servers which could not be polled, if there are any.
+func (w *watcher) Once() error {
+	infos := w.poll()
+	w.queue.close()
+	w.publishStates()
+	var failed []string
+	for _, info := range infos {
+		if info.Stale() {
+			failed = append(failed, info.Name)
+		}
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("could not poll %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Shutdown stops polling the servers and cancels all outstanding requests to the control panels. It returns after
+// the pending state was published, or after the requests of the publishers were cancelled, if publishing takes longer
+// than shutdownTimeout.
+func (w *watcher) Shutdown() {
+	w.cancel()
+	w.ticker.Stop()
+	w.loop.Wait()
+	w.queue.close()
+	t := time.AfterFunc(shutdownTimeout, w.cancelPublish)
+	defer t.Stop()
+	w.publishing.Wait()
+	w.cancelPublish()
+}
+
+// ServerPassword returns the server name and password of the last successful poll of the server with the given name.
+func (w *watcher) ServerPassword(name string) (string, string, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	si, ok := w.last[name]
+	if !ok {
+		return "", "", false
+	}
+	return si.ServerName, si.ServerPassword, true
+}
+
+// Poll triggers a poll of all servers outside the regular poll interval.
+func (w *watcher) Poll() {
+	select {
+	case w.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// SetServerInfo writes the server name and password of the server with the given name to the control panel and
+// triggers a poll of all servers afterward.
+func (w *watcher) SetServerInfo(name, serverName, password string) error {
+	server, ok := w.server(name)
+	if !ok {
+		return fmt.Errorf("unknown server %s", name)
+	}
+	setter, ok := server.Query.(ServerInfoSetter)
+	if !ok {
+		return fmt.Errorf("server %s does not support setting the server info", name)
+	}
+	ctx, cancel := context.WithTimeout(w.ctx, timeout(server))
+	defer cancel()
+	if err := setter.SetServerInfo(ctx, server.Config.ServiceId, serverName, password); err != nil {
+		return err
+	}
+	if password == "" {
+		w.mu.Lock()
+		w.removed[name] = true
+		w.mu.Unlock()
+	}
+	w.Poll()
+	return nil
+}
+
+// Restart restarts the server with the given name through the control panel and returns the status reported by it.
+func (w *watcher) Restart(name string) (string, error) {
+	server, ok := w.server(name)
+	if !ok {
+		return "", fmt.Errorf("unknown server %s", name)
+	}
+	restarter, ok := server.Query.(ServerRestarter)
+	if !ok {
+		return "", fmt.Errorf("server %s does not support restarting", name)
+	}
+	ctx, cancel := context.WithTimeout(w.ctx, timeout(server))
+	defer cancel()
+	return restarter.Restart(ctx, server.Config.ServiceId)
+}
+
+// Reload replaces the servers and publishers of the watcher and changes the poll interval and concurrency. Servers
+// which are not part of servers anymore are forgotten, and a poll is triggered to publish new servers immediately.
+func (w *watcher) Reload(servers []Server, publishers []Publisher, d time.Duration, concurrency int) {
+	w.mu.Lock()
+	w.servers = servers
+	w.publishers = publishers
+	w.concurrency = max(concurrency, 1)
+	names := map[string]bool{}
+	for _, server := range servers {
+		names[server.Config.Name] = true
+	}
+	maps.DeleteFunc(w.last, func(name string, _ ServerInfo) bool { return !names[name] })
+	maps.DeleteFunc(w.removed, func(name string, _ bool) bool { return !names[name] })
+	maps.DeleteFunc(w.unparseable, func(name string, _ bool) bool { return !names[name] })
+	maps.DeleteFunc(w.missingPassword, func(name string, _ int) bool { return !names[name] })
+	w.mu.Unlock()
+	w.ticker.Reset(d)
+	w.Poll()
+}
+
+func (w *watcher) server(name string) (Server, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, server := range w.servers {
+		if server.Config.Name == name {
+			return server, true
+		}
+	}
+	return Server{}, false
+}
+
+// timeout returns the maximum duration of a call to the control panel of the server.
+func timeout(server Server) time.Duration {
+	if server.Config.TimeoutSeconds != nil {
+		return time.Duration(*server.Config.TimeoutSeconds) * time.Second
+	}
+	return defaultTimeout
 }
 
 func (w *watcher) watchServers() {
+	w.poll()
 	for {
 		select {
+		case <-w.ctx.Done():
+			return
 		case <-w.ticker.C:
 			w.poll()
+		case <-w.refresh:
+			w.poll()
 		}
 	}
 }
@@ -58,89 +247,166 @@ func String(v *string) string {
 	return *v
 }
 
-func (w *watcher) poll() {
-	var servers []serverInfo
-	for _, server := range w.servers {
-		pwSource := tcadmin.PasswordSourceConfigPage
-		if String(server.Config.Hoster) == "streamline" {
-			pwSource = tcadmin.PasswordSourceServiceCmdLine
+// poll queries all servers and queues their state for publishing. It returns the state of the servers, or nil if
+// polling was cancelled.
+func (w *watcher) poll() []ServerInfo {
+	w.mu.RLock()
+	servers, concurrency := w.servers, w.concurrency
+	w.mu.RUnlock()
+	results := queryAll(w.ctx, servers, concurrency)
+	if w.ctx.Err() != nil {
+		return nil
+	}
+	infos, changes, alerts := w.collect(servers, results, time.Now())
+	w.saveLastKnown()
+	w.queue.push(State{Servers: infos, Changes: changes, Alerts: alerts})
+	return infos
+}
+
+// publishStates publishes the polled states one after another, until the queue is closed. Publishing never runs
+// concurrently, hence publishers do not need to synchronize the messages they manage.
+func (w *watcher) publishStates() {
+	for {
+		state, ok := w.queue.pop()
+		if !ok {
+			return
+		}
+		w.mu.RLock()
+		publishers := w.publishers
+		w.mu.RUnlock()
+		for _, p := range publishers {
+			p.Publish(w.publishCtx, state)
+		}
+	}
+}
+
+// saveLastKnown persists the last known values of all servers, so that they survive a restart.
+func (w *watcher) saveLastKnown() {
+	w.mu.RLock()
+	values := map[string]internal.LastKnown{}
+	for name, info := range w.last {
+		values[name] = internal.LastKnown{
+			ServerName:     info.ServerName,
+			ServerPassword: info.ServerPassword,
+			LastSuccess:    info.LastSuccess,
+		}
+	}
+	w.mu.RUnlock()
+	if err := w.state.SetLastKnown(values); err != nil {
+		w.logger.Error("save-state", "error", err)
+	}
+}
+
+// collect converts the query results of the servers into the infos to publish and remembers successful results as the
+// last known values of the servers. Servers which failed to be queried are published with their last known values
+// marked as stale, if there are any. Alerts contains messages for the admins about servers which recently became
+// unparseable. A password which disappeared is accepted as removed after passwordRemovedPolls consecutive polls.
+func (w *watcher) collect(servers []Server, results []queryResult, now time.Time) (infos []ServerInfo, changes []Change, alerts []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for idx, r := range results {
+		server := servers[idx]
+		name := server.Config.Name
+		previous, ok := w.last[name]
+		err := r.err
+		if err == nil {
+			var p *ServerInfo
+			if ok {
+				p = &previous
+			}
+			if r.info.Name != "" && r.info.Password == "" {
+				w.missingPassword[name]++
+			} else {
+				delete(w.missingPassword, name)
+			}
+			err = validate(r.info, p, w.removed[name] || w.missingPassword[name] >= passwordRemovedPolls)
 		}
-		si, err := server.Query.ServerInfo(server.Config.ServiceId, tcadmin.ServerInfoOptions{PasswordSource: pwSource})
-		if os.IsTimeout(err) ||
-			errors.Is(err, syscall.ECONNRESET) ||
-			errors.Is(err, syscall.ECONNREFUSED) ||
-			errors.Is(err, syscall.EPIPE) {
-			servers = append(servers, serverInfo{
-				Name:           server.Config.Name,
-				Color:          server.Config.Color,
-				ServerName:     "Connection error",
-				ServerPassword: "",
-			})
+		if err != nil {
+			qe := classify(err)
+			w.logger.Error("server-query", "server", name, "kind", qe.Kind, "error", err)
+			if qe.Kind == FailureUnparseable && !w.unparseable[name] {
+				w.unparseable[name] = true
+				alerts = append(alerts, "The control panel of "+name+" could not be read ("+qe.Err.Error()+"), "+
+					"scraping the server info might be broken. The last known values are shown until this is resolved.")
+			}
+			infos = append(infos, failed(server, qe, previous, ok))
 			continue
-		} else if err != nil {
-			w.logger.Error("server-query", "server", server.Config.Name, "error", err)
-			return
 		}
-		servers = append(servers, serverInfo{
-			Name:           server.Config.Name,
+		delete(w.unparseable, name)
+		delete(w.removed, name)
+		info := ServerInfo{
+			Name:           name,
 			Color:          server.Config.Color,
-			ServerName:     si.Name,
-			ServerPassword: si.Password,
-		})
+			ServerName:     r.info.Name,
+			ServerPassword: r.info.Password,
+			LastSuccess:    now,
+		}
+		w.last[name] = info
+		if ok {
+			if c, changed := diff(previous, info, server.Config.NotifyRole); changed {
+				changes = append(changes, c)
+			}
+		}
+		infos = append(infos, info)
 	}
-	go w.publish(servers)
+	return
 }
 
-func (w *watcher) publish(s []serverInfo) {
-	if w.c.Discord.MessageId == nil {
-		w.createMessage(s)
-	} else {
-		w.updateMessage(s)
+func failed(server Server, err *QueryError, last ServerInfo, known bool) ServerInfo {
+	info := ServerInfo{
+		Name:    server.Config.Name,
+		Color:   server.Config.Color,
+		Failure: err.Kind,
 	}
+	if known {
+		info.ServerName = last.ServerName
+		info.ServerPassword = last.ServerPassword
+		info.LastSuccess = last.LastSuccess
+	}
+	return info
 }
 
-func (w *watcher) createMessage(s []serverInfo) {
-	message, err := w.s.ChannelMessageSendComplex(w.c.Discord.ChannelId, &discordgo.MessageSend{
-		Embeds: serverStatus(s),
-	})
-	if err != nil {
-		w.logger.Error("create-message", "error", err)
-	} else {
-		w.c.Discord.MessageId = &message.ID
+type queryResult struct {
+	info *tcadmin.ServerInfo
+	err  error
+}
+
+// queryAll queries all servers concurrently, with at most concurrency queries at the same time. The results are
+// returned in the order of the servers.
+func queryAll(ctx context.Context, servers []Server, concurrency int) []queryResult {
+	results := make([]queryResult, len(servers))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for range min(concurrency, len(servers)) {
+		wg.Go(func() {
+			for idx := range indices {
+				si, err := Query(ctx, servers[idx])
+				results[idx] = queryResult{info: si, err: err}
+			}
+		})
 	}
+	for idx := range servers {
+		indices <- idx
+	}
+	close(indices)
+	wg.Wait()
+	return results
 }
 
-func (w *watcher) updateMessage(s []serverInfo) {
-	message, err := w.s.ChannelMessageEditComplex(&discordgo.MessageEdit{
-		Embeds:  new(serverStatus(s)),
-		ID:      *w.c.Discord.MessageId,
-		Channel: w.c.Discord.ChannelId,
+// Query queries the server info of a single server from its control panel, with the timeout of the server.
+func Query(ctx context.Context, server Server) (*tcadmin.ServerInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout(server))
+	defer cancel()
+	return server.Query.ServerInfo(ctx, server.Config.ServiceId, tcadmin.ServerInfoOptions{
+		PasswordSource: PasswordSource(server.Config),
 	})
-
-	if err != nil {
-		w.logger.Error("create-message", "error", err)
-	} else {
-		w.c.Discord.MessageId = &message.ID
-	}
 }
 
-func serverStatus(s []serverInfo) (embeds []*discordgo.MessageEmbed) {
-	for _, info := range s {
-		color := internal.ColorDarkGrey
-		if info.Color != nil {
-			color = *info.Color
-		}
-		embeds = append(embeds, &discordgo.MessageEmbed{
-			Title: info.Name,
-			Color: color,
-			Fields: []*discordgo.MessageEmbedField{{
-				Name:  "Server Name",
-				Value: info.ServerName,
-			}, {
-				Name:  "Password",
-				Value: info.ServerPassword,
-			}},
-		})
+// PasswordSource returns where the password of the server is read from in the control panel, which depends on the
+// hoster of the server.
+func PasswordSource(server internal.Server) tcadmin.PasswordSource {
+	if String(server.Hoster) == "streamline" {
+		return tcadmin.PasswordSourceServiceCmdLine
 	}
-	return
+	return tcadmin.PasswordSourceConfigPage
 }
@@ -0,0 +1,40 @@
+package watcher
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestWatcher(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Watcher Suite")
+}
+
+var stateDir string
+var states int
+
+var _ = BeforeSuite(func() {
+	var err error
+	stateDir, err = os.MkdirTemp(os.TempDir(), "watcher")
+	Expect(err).ToNot(HaveOccurred())
+})
+
+var _ = AfterSuite(func() {
+	_ = os.RemoveAll(stateDir)
+})
+
+// newState creates an empty state in a file, which is not used by any other test.
+func newState() *internal.State {
+	states++
+	path := filepath.Join(stateDir, "state-"+strconv.Itoa(states)+".json")
+	s, err := internal.NewState(path, &internal.Config{}, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	Expect(err).ToNot(HaveOccurred())
+	return s
+}
@@ -0,0 +1,370 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/floriansw/go-tcadmin"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeQuery struct {
+	delay   time.Duration
+	info    *tcadmin.ServerInfo
+	err     error
+	running *atomic.Int32
+	maxSeen *atomic.Int32
+}
+
+func (f *fakeQuery) ServerInfo(ctx context.Context, _ string, _ tcadmin.ServerInfoOptions) (*tcadmin.ServerInfo, error) {
+	if f.running != nil {
+		n := f.running.Add(1)
+		defer f.running.Add(-1)
+		for {
+			m := f.maxSeen.Load()
+			if n <= m || f.maxSeen.CompareAndSwap(m, n) {
+				break
+			}
+		}
+	}
+	select {
+	case <-time.After(f.delay):
+		return f.info, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type fakePublisher struct {
+	// blocking publishers wait until their context is done
+	blocking bool
+	delay    time.Duration
+	running  *atomic.Int32
+	maxSeen  *atomic.Int32
+
+	mu     sync.Mutex
+	states []State
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, s State) {
+	if f.running != nil {
+		n := f.running.Add(1)
+		defer f.running.Add(-1)
+		for {
+			m := f.maxSeen.Load()
+			if n <= m || f.maxSeen.CompareAndSwap(m, n) {
+				break
+			}
+		}
+	}
+	time.Sleep(f.delay)
+	if f.blocking {
+		<-ctx.Done()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states = append(f.states, s)
+}
+
+func (f *fakePublisher) published() []State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.states
+}
+
+func server(name string, q ServerQuery) Server {
+	return Server{Query: q, Config: internal.Server{Name: name, ServiceId: name}}
+}
+
+var _ = Describe("Watcher", func() {
+	l := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	Describe("queryAll", func() {
+		It("returns the results in the order of the servers", func() {
+			w := NewWatcher(l, []Server{
+				server("slow", &fakeQuery{delay: 50 * time.Millisecond, info: &tcadmin.ServerInfo{Name: "Slow"}}),
+				server("fast", &fakeQuery{info: &tcadmin.ServerInfo{Name: "Fast"}}),
+			}, nil, newState(), time.Minute, 2)
+
+			r := queryAll(w.ctx, w.servers, w.concurrency)
+
+			Expect(r).To(HaveLen(2))
+			Expect(r[0].info.Name).To(Equal("Slow"))
+			Expect(r[1].info.Name).To(Equal("Fast"))
+		})
+
+		It("queries at most the configured number of servers at the same time", func() {
+			var running, maxSeen atomic.Int32
+			var servers []Server
+			for _, name := range []string{"a", "b", "c", "d", "e"} {
+				servers = append(servers, server(name, &fakeQuery{
+					delay:   10 * time.Millisecond,
+					info:    &tcadmin.ServerInfo{},
+					running: &running,
+					maxSeen: &maxSeen,
+				}))
+			}
+			w := NewWatcher(l, servers, nil, newState(), time.Minute, 2)
+
+			Expect(queryAll(w.ctx, w.servers, w.concurrency)).To(HaveLen(5))
+			Expect(maxSeen.Load()).To(BeNumerically("<=", 2))
+		})
+	})
+	Describe("Run", func() {
+		It("publishes the state to all publishers", func() {
+			first, second := &fakePublisher{}, &fakePublisher{}
+			w := NewWatcher(l, []Server{
+				server("healthy", &fakeQuery{info: &tcadmin.ServerInfo{Name: "Healthy", Password: "pw"}}),
+				server("failing", &fakeQuery{err: errors.New("invalid username or password")}),
+			}, []Publisher{first, second}, newState(), time.Hour, 1)
+			w.Run()
+			defer w.Shutdown()
+
+			Eventually(first.published).Should(HaveLen(1))
+			Eventually(second.published).Should(HaveLen(1))
+			state := first.published()[0]
+			Expect(state.Servers).To(HaveLen(2))
+			Expect(state.Servers[0].ServerPassword).To(Equal("pw"))
+			Expect(state.Servers[1].Failure).To(Equal(FailureAuthentication))
+		})
+	})
+
+	Describe("NewWatcher", func() {
+		It("restores the last known values from the state", func() {
+			state := newState()
+			Expect(state.SetLastKnown(map[string]internal.LastKnown{
+				"failing": {ServerName: "Failing", ServerPassword: "secret", LastSuccess: time.Now()},
+			})).To(Succeed())
+			w := NewWatcher(l, []Server{server("failing", &fakeQuery{})}, nil, state, time.Hour, 1)
+
+			servers, _, _ := w.collect(w.servers, []queryResult{{err: errors.New("invalid username or password")}}, time.Now())
+
+			Expect(servers[0].Stale()).To(BeTrue())
+			Expect(servers[0].ServerPassword).To(Equal("secret"))
+		})
+	})
+
+	Describe("Reload", func() {
+		It("polls added servers and forgets removed ones", func() {
+			p := &fakePublisher{}
+			w := NewWatcher(l, []Server{
+				server("removed", &fakeQuery{info: &tcadmin.ServerInfo{Name: "Removed"}}),
+			}, []Publisher{p}, newState(), time.Hour, 1)
+			w.Run()
+			defer w.Shutdown()
+			Eventually(p.published).Should(HaveLen(1))
+
+			w.Reload([]Server{
+				server("added", &fakeQuery{info: &tcadmin.ServerInfo{Name: "Added"}}),
+			}, []Publisher{p}, time.Hour, 1)
+
+			Eventually(p.published).Should(HaveLen(2))
+			Expect(p.published()[1].Servers).To(HaveLen(1))
+			Expect(p.published()[1].Servers[0].Name).To(Equal("added"))
+			_, _, ok := w.ServerPassword("removed")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("publishing", func() {
+		It("never publishes concurrently", func() {
+			var running, maxSeen atomic.Int32
+			p := &fakePublisher{delay: 20 * time.Millisecond, running: &running, maxSeen: &maxSeen}
+			w := NewWatcher(l, []Server{
+				server("healthy", &fakeQuery{info: &tcadmin.ServerInfo{Name: "Healthy"}}),
+			}, []Publisher{p}, newState(), time.Millisecond, 1)
+			w.Run()
+
+			Eventually(p.published).Should(HaveLen(3))
+			w.Shutdown()
+			Expect(maxSeen.Load()).To(Equal(int32(1)))
+		})
+
+		It("cancels publishing on shutdown after the timeout", func() {
+			shutdownTimeout = 10 * time.Millisecond
+			defer func() { shutdownTimeout = 10 * time.Second }()
+			var running, maxSeen atomic.Int32
+			p := &fakePublisher{blocking: true, running: &running, maxSeen: &maxSeen}
+			w := NewWatcher(l, []Server{
+				server("healthy", &fakeQuery{info: &tcadmin.ServerInfo{Name: "Healthy"}}),
+			}, []Publisher{p}, newState(), time.Hour, 1)
+			w.Run()
+			Eventually(running.Load).Should(Equal(int32(1)))
+
+			w.Shutdown()
+
+			Expect(p.published()).To(HaveLen(1))
+		})
+	})
+
+	Describe("Once", func() {
+		It("publishes a single poll and returns", func() {
+			p := &fakePublisher{}
+			w := NewWatcher(l, []Server{
+				server("healthy", &fakeQuery{info: &tcadmin.ServerInfo{Name: "Healthy"}}),
+			}, []Publisher{p}, newState(), time.Millisecond, 1)
+
+			Expect(w.Once()).To(Succeed())
+
+			Expect(p.published()).To(HaveLen(1))
+		})
+
+		It("reports the servers which could not be polled", func() {
+			p := &fakePublisher{}
+			w := NewWatcher(l, []Server{
+				server("healthy", &fakeQuery{info: &tcadmin.ServerInfo{Name: "Healthy"}}),
+				server("broken", &fakeQuery{err: errors.New("connection refused")}),
+			}, []Publisher{p}, newState(), time.Millisecond, 1)
+
+			Expect(w.Once()).To(MatchError("could not poll broken"))
+			Expect(p.published()).To(HaveLen(1))
+		})
+	})
+
+	Describe("Shutdown", func() {
+		It("cancels outstanding queries", func() {
+			w := NewWatcher(l, []Server{
+				server("hanging", &fakeQuery{delay: time.Hour}),
+			}, nil, newState(), time.Hour, 1)
+			w.Run()
+			w.Poll()
+			time.Sleep(10 * time.Millisecond)
+
+			done := make(chan struct{})
+			go func() {
+				w.Shutdown()
+				close(done)
+			}()
+
+			Eventually(done).Should(BeClosed())
+		})
+	})
+	Describe("collect", func() {
+		var w *watcher
+		now := time.Now()
+
+		BeforeEach(func() {
+			w = NewWatcher(l, []Server{
+				server("healthy", &fakeQuery{}),
+				server("failing", &fakeQuery{}),
+			}, nil, newState(), time.Hour, 1)
+		})
+
+		It("publishes healthy servers when another server fails", func() {
+			servers, _, _ := w.collect(w.servers, []queryResult{
+				{info: &tcadmin.ServerInfo{Name: "Healthy", Password: "pw"}},
+				{err: errors.New("invalid username or password")},
+			}, now)
+
+			Expect(servers).To(HaveLen(2))
+			Expect(servers[0].Stale()).To(BeFalse())
+			Expect(servers[0].ServerName).To(Equal("Healthy"))
+			Expect(servers[1].Stale()).To(BeTrue())
+			Expect(servers[1].LastSuccess.IsZero()).To(BeTrue())
+		})
+
+		It("keeps the last known values of failed servers", func() {
+			w.collect(w.servers, []queryResult{
+				{info: &tcadmin.ServerInfo{Name: "Healthy", Password: "pw"}},
+				{info: &tcadmin.ServerInfo{Name: "Failing", Password: "secret"}},
+			}, now)
+
+			servers, changes, _ := w.collect(w.servers, []queryResult{
+				{info: &tcadmin.ServerInfo{Name: "Healthy", Password: "pw"}},
+				{err: errors.New("invalid username or password")},
+			}, now.Add(time.Minute))
+
+			Expect(changes).To(BeEmpty())
+			Expect(servers[1].Stale()).To(BeTrue())
+			Expect(servers[1].ServerName).To(Equal("Failing"))
+			Expect(servers[1].ServerPassword).To(Equal("secret"))
+			Expect(servers[1].LastSuccess).To(Equal(now))
+			Expect(serverStatus(servers)[1].Fields[2].Value).To(Equal(fmt.Sprintf("<t:%d:R>", now.Unix())))
+		})
+
+		It("renders a removed password as none", func() {
+			embeds := serverStatus([]ServerInfo{
+				{Name: "A", ServerName: "Server", LastSuccess: now},
+				{Name: "B", ServerName: "Server", LastSuccess: now, Failure: FailureTimeout},
+			})
+
+			Expect(embeds[0].Fields[1].Value).To(Equal("_none_"))
+			Expect(embeds[1].Fields[1].Value).To(Equal("_none_"))
+		})
+
+		It("treats an empty server name as unparseable and alerts only once", func() {
+			results := []queryResult{
+				{info: &tcadmin.ServerInfo{Name: "Healthy", Password: "pw"}},
+				{info: &tcadmin.ServerInfo{}},
+			}
+
+			servers, _, alerts := w.collect(w.servers, results, now)
+			Expect(servers[1].Failure).To(Equal(FailureUnparseable))
+			Expect(alerts).To(HaveLen(1))
+
+			_, _, alerts = w.collect(w.servers, results, now)
+			Expect(alerts).To(BeEmpty())
+		})
+
+		It("treats a disappeared password as unparseable", func() {
+			w.collect(w.servers, []queryResult{
+				{info: &tcadmin.ServerInfo{Name: "Healthy", Password: "pw"}},
+				{info: &tcadmin.ServerInfo{Name: "Failing", Password: "secret"}},
+			}, now)
+
+			servers, changes, _ := w.collect(w.servers, []queryResult{
+				{info: &tcadmin.ServerInfo{Name: "Healthy", Password: "pw"}},
+				{info: &tcadmin.ServerInfo{Name: "Failing"}},
+			}, now)
+
+			Expect(changes).To(BeEmpty())
+			Expect(servers[1].Failure).To(Equal(FailureUnparseable))
+			Expect(servers[1].ServerPassword).To(Equal("secret"))
+		})
+
+		It("accepts a password removed through the watcher", func() {
+			w.collect(w.servers, []queryResult{
+				{info: &tcadmin.ServerInfo{Name: "Healthy", Password: "pw"}},
+				{info: &tcadmin.ServerInfo{Name: "Failing", Password: "secret"}},
+			}, now)
+			w.removed["failing"] = true
+
+			servers, changes, _ := w.collect(w.servers, []queryResult{
+				{info: &tcadmin.ServerInfo{Name: "Healthy", Password: "pw"}},
+				{info: &tcadmin.ServerInfo{Name: "Failing"}},
+			}, now)
+
+			Expect(servers[1].Stale()).To(BeFalse())
+			Expect(changes).To(HaveLen(1))
+		})
+
+		It("accepts a password removed in the control panel after consecutive polls without it", func() {
+			w.collect(w.servers, []queryResult{
+				{info: &tcadmin.ServerInfo{Name: "Healthy", Password: "pw"}},
+				{info: &tcadmin.ServerInfo{Name: "Failing", Password: "secret"}},
+			}, now)
+			results := []queryResult{
+				{info: &tcadmin.ServerInfo{Name: "Healthy", Password: "pw"}},
+				{info: &tcadmin.ServerInfo{Name: "Failing"}},
+			}
+
+			for range passwordRemovedPolls - 1 {
+				servers, _, _ := w.collect(w.servers, results, now)
+				Expect(servers[1].Failure).To(Equal(FailureUnparseable))
+			}
+			servers, changes, _ := w.collect(w.servers, results, now)
+
+			Expect(servers[1].Stale()).To(BeFalse())
+			Expect(servers[1].ServerPassword).To(BeEmpty())
+			Expect(changes).To(HaveLen(1))
+		})
+	})
+})
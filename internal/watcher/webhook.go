@@ -0,0 +1,171 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+)
+
+// webhookPublisher publishes the status of all servers through a discord webhook. The webhook is executed once and
+// the resulting messages are edited with each poll, hence no bot is needed.
+type webhookPublisher struct {
+	logger  *slog.Logger
+	hc      *http.Client
+	url     string
+	servers []string
+	state   *internal.State
+	// removed is true, if the webhook is not configured anymore and its messages need to be deleted
+	removed bool
+}
+
+// NewWebhookPublisher creates a Publisher for the webhook with the given URL, which publishes the servers with the
+// given names, or all servers if servers is empty. The IDs of the executed messages are stored in state.
+func NewWebhookPublisher(l *slog.Logger, hc *http.Client, url string, servers []string, state *internal.State) *webhookPublisher {
+	return &webhookPublisher{
+		logger:  l,
+		hc:      hc,
+		url:     url,
+		servers: servers,
+		state:   state,
+	}
+}
+
+// NewRemovedWebhookPublisher creates a Publisher for a webhook, which is not configured anymore. It deletes the
+// messages previously executed through the webhook and publishes nothing else.
+func NewRemovedWebhookPublisher(l *slog.Logger, hc *http.Client, url string, state *internal.State) *webhookPublisher {
+	p := NewWebhookPublisher(l, hc, url, nil, state)
+	p.removed = true
+	return p
+}
+
+func (p *webhookPublisher) Publish(ctx context.Context, s State) {
+	if p.removed {
+		p.deleteMessages(ctx, p.state.WebhookMessages(p.url))
+		if err := p.state.SetWebhookMessages(p.url, nil); err != nil {
+			p.logger.Error("save-state", "error", err)
+		}
+		return
+	}
+	var infos []ServerInfo
+	for _, info := range s.Servers {
+		if p.publishes(info.Name) {
+			infos = append(infos, info)
+		}
+	}
+	messages := syncMessages(ctx, p.logger, p, paginate(serverStatus(infos)), p.state.WebhookMessages(p.url))
+	if err := p.state.SetWebhookMessages(p.url, messages); err != nil {
+		p.logger.Error("save-state", "error", err)
+	}
+	for _, c := range s.Changes {
+		if !p.publishes(c.Current.Name) {
+			continue
+		}
+		// roles can not be mentioned, as the webhook might belong to a different discord server
+		c.Role = nil
+		if _, err := p.execute(ctx, changeNotification(c)); err != nil {
+			p.logger.Error("notify-change", "server", c.Current.Name, "error", err)
+		}
+	}
+}
+
+// publishes returns true if the server with the given name is published through the webhook.
+func (p *webhookPublisher) publishes(name string) bool {
+	return len(p.servers) == 0 || slices.Contains(p.servers, name)
+}
+
+func (p *webhookPublisher) createMessage(ctx context.Context, embeds []*discordgo.MessageEmbed) (string, error) {
+	return p.execute(ctx, &discordgo.MessageSend{Embeds: embeds})
+}
+
+func (p *webhookPublisher) updateMessage(ctx context.Context, id string, embeds []*discordgo.MessageEmbed) error {
+	err := p.do(ctx, http.MethodPatch, "/messages/"+id, &discordgo.WebhookEdit{Embeds: &embeds}, nil)
+	if isDiscordError(err, discordgo.ErrCodeUnknownMessage, discordgo.ErrCodeUnknownWebhook) {
+		return fmt.Errorf("%w: %w", errMessageGone, err)
+	}
+	return err
+}
+
+func (p *webhookPublisher) deleteMessages(ctx context.Context, messages []internal.Message) {
+	for _, m := range messages {
+		err := p.do(ctx, http.MethodDelete, "/messages/"+m.Id, nil, nil)
+		if err != nil && !isDiscordError(err, discordgo.ErrCodeUnknownMessage, discordgo.ErrCodeUnknownWebhook) {
+			p.logger.Error("delete-message", "message", m.Id, "error", err)
+		}
+	}
+}
+
+// execute posts a new message through the webhook and returns its ID.
+func (p *webhookPublisher) execute(ctx context.Context, m *discordgo.MessageSend) (string, error) {
+	var message discordgo.Message
+	if err := p.do(ctx, http.MethodPost, "", m, &message); err != nil {
+		return "", err
+	}
+	return message.ID, nil
+}
+
+// do sends a request to the given path relative to the webhook URL and retries it, if discord is temporarily
+// unavailable. Responses which are not successful are returned as *discordgo.RESTError, like the errors of the
+// discord session.
+func (p *webhookPublisher) do(ctx context.Context, method, path string, body, result any) error {
+	return retry(ctx, p.logger, "webhook", func() error {
+		return p.request(ctx, method, path, body, result)
+	})
+}
+
+func (p *webhookPublisher) request(ctx context.Context, method, path string, body, result any) error {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return err
+	}
+	u.Path += path
+	if method == http.MethodPost {
+		q := u.Query()
+		q.Set("wait", "true")
+		u.RawQuery = q.Encode()
+	}
+	var b io.Reader
+	if body != nil {
+		j, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		b = bytes.NewReader(j)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), b)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := p.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		restErr := &discordgo.RESTError{Request: req, Response: res, ResponseBody: resBody}
+		var msg discordgo.APIErrorMessage
+		if json.Unmarshal(resBody, &msg) == nil {
+			restErr.Message = &msg
+		}
+		return restErr
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resBody, result)
+}
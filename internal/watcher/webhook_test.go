@@ -0,0 +1,169 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/floriansw/hll-discord-server-watcher/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type webhookRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Body   map[string]any
+}
+
+// fakeWebhook stands in for the discord webhook API and records the requests it received.
+type fakeWebhook struct {
+	mu       sync.Mutex
+	requests []webhookRequest
+	missing  map[string]bool
+	nextId   int
+}
+
+func (f *fakeWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	req := webhookRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery}
+	b, _ := io.ReadAll(r.Body)
+	_ = json.Unmarshal(b, &req.Body)
+	f.requests = append(f.requests, req)
+
+	if f.missing[r.URL.Path] {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"code": 10008, "message": "Unknown Message"}`))
+		return
+	}
+	if r.Method == http.MethodPost {
+		f.nextId++
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": strconv.Itoa(f.nextId)})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeWebhook) received() []webhookRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	defer func() { f.requests = nil }()
+	return f.requests
+}
+
+var _ = Describe("WebhookPublisher", func() {
+	var fake *fakeWebhook
+	var srv *httptest.Server
+	var st *internal.State
+	var p *webhookPublisher
+	url := "/api/webhooks/1/token"
+
+	BeforeEach(func() {
+		fake = &fakeWebhook{missing: map[string]bool{}}
+		srv = httptest.NewServer(fake)
+		st = newState()
+		p = NewWebhookPublisher(slog.New(slog.NewTextHandler(os.Stdout, nil)), srv.Client(), srv.URL+url, nil, st)
+	})
+
+	AfterEach(func() {
+		srv.Close()
+	})
+
+	state := func(password string) State {
+		return State{Servers: []ServerInfo{{Name: "A", ServerName: "Server A", ServerPassword: password}}}
+	}
+
+	It("executes the webhook once and edits the message afterward", func() {
+		p.Publish(context.Background(), state("one"))
+
+		r := fake.received()
+		Expect(r).To(HaveLen(1))
+		Expect(r[0].Method).To(Equal(http.MethodPost))
+		Expect(r[0].Path).To(Equal("/api/webhooks/1/token"))
+		Expect(r[0].Query).To(Equal("wait=true"))
+		Expect(r[0].Body["embeds"]).To(HaveLen(1))
+		Expect(st.WebhookMessages(srv.URL + url)).To(HaveLen(1))
+		Expect(st.WebhookMessages(srv.URL + url)[0].Id).To(Equal("1"))
+
+		p.Publish(context.Background(), state("two"))
+
+		r = fake.received()
+		Expect(r).To(HaveLen(1))
+		Expect(r[0].Method).To(Equal(http.MethodPatch))
+		Expect(r[0].Path).To(Equal("/api/webhooks/1/token/messages/1"))
+	})
+
+	It("does not edit the message if the status is unchanged", func() {
+		p.Publish(context.Background(), state("one"))
+		fake.received()
+
+		p.Publish(context.Background(), state("one"))
+
+		Expect(fake.received()).To(BeEmpty())
+	})
+
+	It("executes the webhook again if the message was deleted", func() {
+		p.Publish(context.Background(), state("one"))
+		fake.received()
+		fake.missing["/api/webhooks/1/token/messages/1"] = true
+
+		p.Publish(context.Background(), state("two"))
+
+		r := fake.received()
+		Expect(r).To(HaveLen(2))
+		Expect(r[1].Method).To(Equal(http.MethodPost))
+		Expect(st.WebhookMessages(srv.URL + url)[0].Id).To(Equal("2"))
+	})
+
+	It("publishes only the configured servers", func() {
+		p = NewWebhookPublisher(slog.New(slog.NewTextHandler(os.Stdout, nil)), srv.Client(), srv.URL+url, []string{"A"}, st)
+
+		p.Publish(context.Background(), State{
+			Servers: []ServerInfo{{Name: "A", ServerName: "Server A"}, {Name: "training", ServerName: "Training"}},
+			Changes: []Change{{
+				Previous: ServerInfo{Name: "training", ServerPassword: "one"},
+				Current:  ServerInfo{Name: "training", ServerPassword: "two"},
+			}},
+		})
+
+		r := fake.received()
+		Expect(r).To(HaveLen(1))
+		Expect(r[0].Body["embeds"]).To(HaveLen(1))
+		Expect(r[0].Body["embeds"].([]any)[0].(map[string]any)["title"]).To(Equal("A"))
+	})
+
+	It("deletes the messages of a removed webhook", func() {
+		p.Publish(context.Background(), state("one"))
+		fake.received()
+
+		NewRemovedWebhookPublisher(slog.New(slog.NewTextHandler(os.Stdout, nil)), srv.Client(), srv.URL+url, st).Publish(context.Background(), state("two"))
+
+		r := fake.received()
+		Expect(r).To(HaveLen(1))
+		Expect(r[0].Method).To(Equal(http.MethodDelete))
+		Expect(r[0].Path).To(Equal("/api/webhooks/1/token/messages/1"))
+		Expect(st.WebhookUrls()).To(BeEmpty())
+	})
+
+	It("posts change notifications without mentioning roles", func() {
+		role := "123"
+		p.Publish(context.Background(), State{Changes: []Change{{
+			Previous: ServerInfo{Name: "A", ServerPassword: "one"},
+			Current:  ServerInfo{Name: "A", ServerPassword: "two"},
+			Role:     &role,
+		}}})
+
+		r := fake.received()
+		Expect(r).To(HaveLen(1))
+		Expect(r[0].Method).To(Equal(http.MethodPost))
+		Expect(r[0].Body["content"]).To(BeNil())
+	})
+})